@@ -25,6 +25,7 @@ import (
 func init() {
 	log := tools.GetLogger("init")
 	models.DBConnect(tools.Config.GetString("DBDriver"), tools.Config.GetString("DBSource"))
+	server.ResolveModules()
 	models.BootStrap()
 	server.LoadInternalResources()
 	ir.BootStrap()
@@ -15,28 +15,52 @@
 package ir
 
 import (
+	"sort"
 	"strings"
 
 	"github.com/beevik/etree"
 	"github.com/npiganeau/yep/yep/tools"
 )
 
+/*
+ViewValidator checks the arch of the given view and returns the errors found.
+*/
+type ViewValidator func(v *View) []error
+
+var viewValidators []ViewValidator
+
+/*
+RegisterViewValidator adds the given validator to the functions that check
+every primary view at bootstrap.
+*/
+func RegisterViewValidator(validator ViewValidator) {
+	viewValidators = append(viewValidators, validator)
+}
+
 /*
 BootStrap computes all views, actions and menus after they have been
 added by the modules.
 */
 func BootStrap() {
 	computeViews()
+	validateViews()
 	computeActions()
 }
 
 /*
 ComputeViews makes the necessary updates to view definitions. In particular:
+- applies inheriting views onto the arch of their parent.
 - sets the type of the view from the arch root.
 - populates the fields map from the views arch.
 */
 func computeViews() {
+	resolveInheritance()
+	computeInheritedArchs()
 	for _, v := range ViewsRegistry.views {
+		if v.InheritanceMode == VIEW_EXTENSION {
+			// Extension views are only specs applied on their parent
+			continue
+		}
 		doc := etree.NewDocument()
 		if err := doc.ReadFromString(v.Arch); err != nil {
 			tools.LogAndPanic(log, "Unable to read view", "view", v.ID, "error", err)
@@ -53,6 +77,34 @@ func computeViews() {
 	}
 }
 
+/*
+validateViews runs the registered validators on all primary views. It logs
+every error found with the module, file and ID of the view and then panics
+if there was any.
+*/
+func validateViews() {
+	ids := make([]string, 0, len(ViewsRegistry.views))
+	for id, v := range ViewsRegistry.views {
+		if v.InheritanceMode != VIEW_EXTENSION {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	var errCount int
+	for _, id := range ids {
+		v := ViewsRegistry.views[id]
+		for _, validator := range viewValidators {
+			for _, err := range validator(v) {
+				log.Error("Invalid view", "module", v.Module, "file", v.File, "view", v.ID, "error", err)
+				errCount++
+			}
+		}
+	}
+	if errCount > 0 {
+		tools.LogAndPanic(log, "Invalid views, see errors above", "count", errCount)
+	}
+}
+
 /*
 ComputeActions makes the necessary updates to action definitions. In particular:
 - Add a few default values
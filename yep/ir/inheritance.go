@@ -0,0 +1,265 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/beevik/etree"
+	"github.com/npiganeau/yep/yep/tools"
+)
+
+// Positions of the elements of an inheriting view relative to the
+// element they locate in the parent view.
+const (
+	POSITION_INSIDE     = "inside"
+	POSITION_BEFORE     = "before"
+	POSITION_AFTER      = "after"
+	POSITION_REPLACE    = "replace"
+	POSITION_ATTRIBUTES = "attributes"
+)
+
+// viewsByPriority sorts views by priority, then by ID
+type viewsByPriority []*View
+
+func (v viewsByPriority) Len() int {
+	return len(v)
+}
+
+func (v viewsByPriority) Swap(i, j int) {
+	v[i], v[j] = v[j], v[i]
+}
+
+func (v viewsByPriority) Less(i, j int) bool {
+	if v[i].Priority != v[j].Priority {
+		return v[i].Priority < v[j].Priority
+	}
+	return v[i].ID < v[j].ID
+}
+
+/*
+resolveInheritance links each inheriting view to the view it inherits from,
+and sets the inheritance mode of the views that do not define it: views
+inheriting from another view are extensions, the others are primary views.
+*/
+func resolveInheritance() {
+	for _, v := range ViewsRegistry.views {
+		if v.inheritRef == "" {
+			if v.InheritanceMode == "" {
+				v.InheritanceMode = VIEW_PRIMARY
+			}
+			continue
+		}
+		parent := ViewsRegistry.GetViewById(v.inheritRef)
+		if parent == nil {
+			tools.LogAndPanic(log, "Inherited view not found", "module", v.Module, "view", v.ID, "inherit_id", v.inheritRef)
+		}
+		v.InheritID = parent
+		parent.InheritChildrenIDs = append(parent.InheritChildrenIDs, v)
+		if v.InheritanceMode == "" {
+			v.InheritanceMode = VIEW_EXTENSION
+		}
+		if v.Model == "" {
+			v.Model = parent.Model
+		}
+	}
+	for _, v := range ViewsRegistry.views {
+		sort.Sort(viewsByPriority(v.InheritChildrenIDs))
+	}
+}
+
+/*
+computeInheritedArchs sets the arch of each primary view to its combined arch.
+
+The combined arch of a primary view is its own arch, or the combined arch of the
+view it inherits from modified by its own arch, further modified by the archs of
+its extension views and of their own extension views, by order of priority.
+*/
+func computeInheritedArchs() {
+	archs := make(map[string]string)
+	for _, v := range ViewsRegistry.views {
+		if v.InheritanceMode == VIEW_PRIMARY {
+			combinedArch(v, archs, nil)
+		}
+	}
+	for id, arch := range archs {
+		ViewsRegistry.views[id].Arch = arch
+	}
+}
+
+/*
+combinedArch returns the combined arch of the given primary view and caches it
+in archs. path holds the views being computed to detect inheritance cycles.
+*/
+func combinedArch(v *View, archs map[string]string, path []string) string {
+	if arch, ok := archs[v.ID]; ok {
+		return arch
+	}
+	for _, id := range path {
+		if id == v.ID {
+			tools.LogAndPanic(log, "Inheritance cycle between views", "module", v.Module, "view", v.ID, "views", strings.Join(append(path, v.ID), " -> "))
+		}
+	}
+	path = append(path, v.ID)
+	arch := v.Arch
+	if v.InheritID != nil {
+		// Primary views inheriting from another view derive from the
+		// combined arch of the root primary view of their parent.
+		parent := v.InheritID
+		for parent.InheritanceMode == VIEW_EXTENSION && parent.InheritID != nil {
+			parent = parent.InheritID
+		}
+		arch = applyInheritance(combinedArch(parent, archs, path), v)
+	}
+	arch = applyExtensions(arch, v)
+	archs[v.ID] = arch
+	return arch
+}
+
+/*
+applyExtensions applies on arch the extension views of v and recursively
+their own extension views.
+*/
+func applyExtensions(arch string, v *View) string {
+	for _, child := range v.InheritChildrenIDs {
+		if child.InheritanceMode != VIEW_EXTENSION {
+			continue
+		}
+		arch = applyInheritance(arch, child)
+		arch = applyExtensions(arch, child)
+	}
+	return arch
+}
+
+/*
+applyInheritance returns the given arch modified by the arch of the given
+inheriting view, which is either a single locator element or a <data>
+element with locator elements as children.
+
+Locators are either <xpath expr="..."> elements or elements with the same
+tag and attributes as the element to locate, such as <field name="..."/>.
+Their position attribute tells where their children are put relative to
+the located element, 'inside' by default.
+*/
+func applyInheritance(arch string, v *View) string {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(arch); err != nil {
+		tools.LogAndPanic(log, "Unable to parse parent view arch", "module", v.Module, "view", v.ID, "error", err)
+	}
+	specDoc := etree.NewDocument()
+	if err := specDoc.ReadFromString(v.Arch); err != nil {
+		tools.LogAndPanic(log, "Unable to parse view arch", "module", v.Module, "view", v.ID, "error", err)
+	}
+	specRoot := specDoc.Root()
+	if specRoot == nil {
+		tools.LogAndPanic(log, "Empty inheriting view arch", "module", v.Module, "view", v.ID)
+	}
+	locators := []*etree.Element{specRoot}
+	if specRoot.Tag == "data" {
+		locators = specRoot.ChildElements()
+	}
+	for _, locator := range locators {
+		target := locateElement(doc, locator, v)
+		applyLocator(doc, target, locator, v)
+	}
+	res, err := doc.WriteToString()
+	if err != nil {
+		tools.LogAndPanic(log, "Unable to render view arch", "module", v.Module, "view", v.ID, "error", err)
+	}
+	return res
+}
+
+/*
+locateElement returns the element of doc located by the given locator of view v.
+It panics if no element matches.
+
+Attribute values of shorthand locators cannot contain single quotes since path
+expressions do not support escaping them. Use an xpath locator instead.
+*/
+func locateElement(doc *etree.Document, locator *etree.Element, v *View) *etree.Element {
+	var expr string
+	if locator.Tag == "xpath" {
+		expr = locator.SelectAttrValue("expr", "")
+	} else {
+		expr = "//" + locator.Tag
+		for _, attr := range locator.Attr {
+			if attr.Key == "position" {
+				continue
+			}
+			if strings.Contains(attr.Value, "'") {
+				tools.LogAndPanic(log, "Locator attribute values cannot contain single quotes", "module", v.Module, "view", v.ID, "tag", locator.Tag, "attribute", attr.Key, "value", attr.Value)
+			}
+			expr += fmt.Sprintf("[@%s='%s']", attr.Key, attr.Value)
+		}
+	}
+	path, err := etree.CompilePath(expr)
+	if err != nil {
+		tools.LogAndPanic(log, "Invalid locator in inheriting view", "module", v.Module, "view", v.ID, "expr", expr, "error", err)
+	}
+	target := doc.FindElementPath(path)
+	if target == nil {
+		tools.LogAndPanic(log, "Element cannot be located in parent view", "module", v.Module, "view", v.ID, "parent", v.InheritID.ID, "expr", expr)
+	}
+	return target
+}
+
+/*
+applyLocator applies the given locator of view v on the target element of doc.
+*/
+func applyLocator(doc *etree.Document, target, locator *etree.Element, v *View) {
+	children := locator.ChildElements()
+	switch position := locator.SelectAttrValue("position", POSITION_INSIDE); position {
+	case POSITION_INSIDE:
+		for _, child := range children {
+			target.AddChild(child.Copy())
+		}
+	case POSITION_BEFORE:
+		parent := target.Parent()
+		for _, child := range children {
+			parent.InsertChild(target, child.Copy())
+		}
+	case POSITION_AFTER:
+		parent := target.Parent()
+		index := target.Index() + 1
+		for i, child := range children {
+			parent.InsertChildAt(index+i, child.Copy())
+		}
+	case POSITION_REPLACE:
+		parent := target.Parent()
+		if parent == &doc.Element && len(children) != 1 {
+			tools.LogAndPanic(log, "The root element must be replaced by exactly one element", "module", v.Module, "view", v.ID)
+		}
+		for _, child := range children {
+			parent.InsertChild(target, child.Copy())
+		}
+		parent.RemoveChild(target)
+	case POSITION_ATTRIBUTES:
+		for _, child := range children {
+			if child.Tag != "attribute" {
+				tools.LogAndPanic(log, "Only attribute elements are allowed with position 'attributes'", "module", v.Module, "view", v.ID, "tag", child.Tag)
+			}
+			name := child.SelectAttrValue("name", "")
+			if value := child.Text(); value != "" {
+				target.CreateAttr(name, value)
+			} else {
+				target.RemoveAttr(name)
+			}
+		}
+	default:
+		tools.LogAndPanic(log, "Unknown position in inheriting view", "module", v.Module, "view", v.ID, "position", position)
+	}
+}
@@ -0,0 +1,256 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// inheritanceTestView describes a view for the inheritance tests
+type inheritanceTestView struct {
+	id       string
+	inherit  string
+	mode     ViewInheritanceMode
+	priority uint8
+	arch     string
+}
+
+// computeTestArchs registers the given views in a new views registry,
+// computes their inheritance and returns the resulting arch of each view.
+func computeTestArchs(views []inheritanceTestView) map[string]string {
+	ViewsRegistry = NewViewsCollection()
+	for _, tv := range views {
+		ViewsRegistry.AddView(&View{
+			ID:              tv.id,
+			Model:           "Partner",
+			Type:            VIEW_TYPE_FORM,
+			Priority:        tv.priority,
+			Arch:            tv.arch,
+			InheritanceMode: tv.mode,
+			inheritRef:      tv.inherit,
+		})
+	}
+	resolveInheritance()
+	computeInheritedArchs()
+	res := make(map[string]string)
+	for id, v := range ViewsRegistry.views {
+		res[id] = v.Arch
+	}
+	return res
+}
+
+const baseTestArch = `<form><group name="main"><field name="name" string="Name"/><field name="email"/></group></form>`
+
+func TestViewInheritance(t *testing.T) {
+	Convey("Testing view inheritance", t, func() {
+		Convey("Extension views should modify the arch of their parent", func() {
+			cases := []struct {
+				title    string
+				views    []inheritanceTestView
+				expected map[string]string
+			}{
+				{
+					title: "Position inside is the default",
+					views: []inheritanceTestView{
+						{id: "base", arch: baseTestArch},
+						{id: "ext", inherit: "base", arch: `<group name="main"><field name="phone"/></group>`},
+					},
+					expected: map[string]string{
+						"base": `<form><group name="main"><field name="name" string="Name"/><field name="email"/><field name="phone"/></group></form>`,
+					},
+				},
+				{
+					title: "Position before",
+					views: []inheritanceTestView{
+						{id: "base", arch: baseTestArch},
+						{id: "ext", inherit: "base", arch: `<field name="email" position="before"><field name="ref"/><field name="phone"/></field>`},
+					},
+					expected: map[string]string{
+						"base": `<form><group name="main"><field name="name" string="Name"/><field name="ref"/><field name="phone"/><field name="email"/></group></form>`,
+					},
+				},
+				{
+					title: "Position after",
+					views: []inheritanceTestView{
+						{id: "base", arch: baseTestArch},
+						{id: "ext", inherit: "base", arch: `<field name="name" position="after"><field name="ref"/><field name="phone"/></field>`},
+					},
+					expected: map[string]string{
+						"base": `<form><group name="main"><field name="name" string="Name"/><field name="ref"/><field name="phone"/><field name="email"/></group></form>`,
+					},
+				},
+				{
+					title: "Position replace",
+					views: []inheritanceTestView{
+						{id: "base", arch: baseTestArch},
+						{id: "ext", inherit: "base", arch: `<field name="email" position="replace"><field name="phone"/></field>`},
+					},
+					expected: map[string]string{
+						"base": `<form><group name="main"><field name="name" string="Name"/><field name="phone"/></group></form>`,
+					},
+				},
+				{
+					title: "Position replace on the root element",
+					views: []inheritanceTestView{
+						{id: "base", arch: baseTestArch},
+						{id: "ext", inherit: "base", arch: `<xpath expr="/form" position="replace"><tree><field name="name"/></tree></xpath>`},
+					},
+					expected: map[string]string{
+						"base": `<tree><field name="name"/></tree>`,
+					},
+				},
+				{
+					title: "Position attributes",
+					views: []inheritanceTestView{
+						{id: "base", arch: baseTestArch},
+						{id: "ext", inherit: "base", arch: `<field name="name" position="attributes"><attribute name="required">1</attribute><attribute name="string"></attribute></field>`},
+					},
+					expected: map[string]string{
+						"base": `<form><group name="main"><field name="name" required="1"/><field name="email"/></group></form>`,
+					},
+				},
+				{
+					title: "Shorthand locators match all their attributes",
+					views: []inheritanceTestView{
+						{id: "base", arch: `<form><field name="name"/><field name="name" string="Other"/></form>`},
+						{id: "ext", inherit: "base", arch: `<field name="name" string="Other" position="after"><field name="phone"/></field>`},
+					},
+					expected: map[string]string{
+						"base": `<form><field name="name"/><field name="name" string="Other"/><field name="phone"/></form>`,
+					},
+				},
+				{
+					title: "Data wrappers hold several locators",
+					views: []inheritanceTestView{
+						{id: "base", arch: baseTestArch},
+						{id: "ext", inherit: "base", arch: `<data><xpath expr="//field[@name='name']" position="after"><field name="ref"/></xpath><field name="email" position="replace"/><group name="main"><field name="phone"/></group></data>`},
+					},
+					expected: map[string]string{
+						"base": `<form><group name="main"><field name="name" string="Name"/><field name="ref"/><field name="phone"/></group></form>`,
+					},
+				},
+				{
+					title: "Extensions are applied by priority, then by ID",
+					views: []inheritanceTestView{
+						{id: "base", arch: baseTestArch},
+						{id: "ext_a", inherit: "base", priority: 20, arch: `<group name="main"><field name="a"/></group>`},
+						{id: "ext_b", inherit: "base", priority: 10, arch: `<group name="main"><field name="b"/></group>`},
+						{id: "ext_c", inherit: "base", priority: 10, arch: `<group name="main"><field name="c"/></group>`},
+					},
+					expected: map[string]string{
+						"base": `<form><group name="main"><field name="name" string="Name"/><field name="email"/><field name="b"/><field name="c"/><field name="a"/></group></form>`,
+					},
+				},
+				{
+					title: "Extensions of extensions are applied after their parent",
+					views: []inheritanceTestView{
+						{id: "base", arch: baseTestArch},
+						{id: "ext", inherit: "base", priority: 20, arch: `<field name="name" position="after"><field name="ref"/></field>`},
+						{id: "ext_ext", inherit: "ext", arch: `<field name="ref" position="after"><field name="phone"/></field>`},
+						{id: "other", inherit: "base", priority: 30, arch: `<field name="phone" position="attributes"><attribute name="widget">phone</attribute></field>`},
+					},
+					expected: map[string]string{
+						"base": `<form><group name="main"><field name="name" string="Name"/><field name="ref"/><field name="phone" widget="phone"/><field name="email"/></group></form>`,
+					},
+				},
+				{
+					title: "Primary views derive from the combined arch of their parent",
+					views: []inheritanceTestView{
+						{id: "base", arch: baseTestArch},
+						{id: "ext", inherit: "base", arch: `<field name="email" position="after"><field name="phone"/></field>`},
+						{id: "derived", inherit: "base", mode: VIEW_PRIMARY, arch: `<field name="name" position="replace"/>`},
+						{id: "derived_ext", inherit: "derived", arch: `<field name="phone" position="attributes"><attribute name="widget">phone</attribute></field>`},
+					},
+					expected: map[string]string{
+						"base":    `<form><group name="main"><field name="name" string="Name"/><field name="email"/><field name="phone"/></group></form>`,
+						"derived": `<form><group name="main"><field name="email"/><field name="phone" widget="phone"/></group></form>`,
+					},
+				},
+			}
+			for _, c := range cases {
+				Convey(c.title, func() {
+					archs := computeTestArchs(c.views)
+					for id, arch := range c.expected {
+						So(archs[id], ShouldEqual, arch)
+					}
+				})
+			}
+		})
+		Convey("Extension views should be linked to their parent", func() {
+			computeTestArchs([]inheritanceTestView{
+				{id: "base", arch: baseTestArch},
+				{id: "ext", inherit: "base", arch: `<group name="main"/>`},
+			})
+			base := ViewsRegistry.GetViewById("base")
+			ext := ViewsRegistry.GetViewById("ext")
+			So(base.InheritanceMode, ShouldEqual, VIEW_PRIMARY)
+			So(ext.InheritanceMode, ShouldEqual, VIEW_EXTENSION)
+			So(ext.InheritID, ShouldEqual, base)
+			So(ext.Model, ShouldEqual, "Partner")
+			So(base.InheritChildrenIDs, ShouldContain, ext)
+		})
+		Convey("Invalid inheritance should panic", func() {
+			cases := []struct {
+				title string
+				views []inheritanceTestView
+			}{
+				{
+					title: "Locator that does not match",
+					views: []inheritanceTestView{
+						{id: "base", arch: baseTestArch},
+						{id: "ext", inherit: "base", arch: `<field name="unknown" position="after"><field name="phone"/></field>`},
+					},
+				},
+				{
+					title: "Shorthand locator value with a single quote",
+					views: []inheritanceTestView{
+						{id: "base", arch: `<form><field name="name" string="Partner's name"/></form>`},
+						{id: "ext", inherit: "base", arch: `<field string="Partner's name" position="after"><field name="phone"/></field>`},
+					},
+				},
+				{
+					title: "Unknown inherited view",
+					views: []inheritanceTestView{
+						{id: "ext", inherit: "unknown", arch: `<group name="main"/>`},
+					},
+				},
+				{
+					title: "Inheritance cycle",
+					views: []inheritanceTestView{
+						{id: "view_a", inherit: "view_b", mode: VIEW_PRIMARY, arch: `<form name="a"/>`},
+						{id: "view_b", inherit: "view_a", mode: VIEW_PRIMARY, arch: `<form name="b"/>`},
+					},
+				},
+				{
+					title: "Root element replaced by several elements",
+					views: []inheritanceTestView{
+						{id: "base", arch: baseTestArch},
+						{id: "ext", inherit: "base", arch: `<xpath expr="/form" position="replace"><form/><tree/></xpath>`},
+					},
+				},
+			}
+			for _, c := range cases {
+				Convey(c.title, func() {
+					So(func() { computeTestArchs(c.views) }, ShouldPanic)
+				})
+			}
+		})
+		Reset(func() {
+			ViewsRegistry = NewViewsCollection()
+		})
+	})
+}
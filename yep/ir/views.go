@@ -17,6 +17,7 @@ package ir
 import (
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -132,7 +133,7 @@ GetFirstViewForModel returns the first view of type viewType for the given model
 */
 func (vc *ViewsCollection) GetFirstViewForModel(model string, viewType ViewType) *View {
 	for _, view := range vc.orderedViews[model] {
-		if view.Type == viewType {
+		if view.Type == viewType && view.InheritanceMode != VIEW_EXTENSION {
 			return view
 		}
 	}
@@ -152,19 +153,38 @@ type View struct {
 	FieldParent        string              `json:"field_parent"`
 	InheritanceMode    ViewInheritanceMode `json:"mode"`
 	Fields             []string
+	Module             string `json:"module"`
+	File               string `json:"file"`
+	inheritRef         string
 	//GroupsID []*Group
 }
 
 /*
-LoadViewFromEtree reads the view given etree.Element, creates or updates the view
-and adds it to the view registry if it not already.
+LoadViewFromEtree reads the view given etree.Element of the given module and file,
+creates or updates the view and adds it to the view registry if it not already.
+
+The inherit_id field references the ID of the view this view inherits from,
+either in its ref attribute or as text.
 */
-func LoadViewFromEtree(element *etree.Element) {
+func LoadViewFromEtree(module, file string, element *etree.Element) {
 	// We populate a viewHash from XML data fields
 	viewHash := make(map[string]interface{})
 	viewHash["id"] = element.SelectAttrValue("id", "NO_ID")
+	var inheritRef string
 	for _, fieldNode := range element.FindElements("field") {
 		name := fieldNode.SelectAttrValue("name", "NO_NAME")
+		switch name {
+		case "inherit_id":
+			inheritRef = fieldNode.SelectAttrValue("ref", strings.TrimSpace(fieldNode.Text()))
+			continue
+		case "priority":
+			priority, err := strconv.ParseUint(strings.TrimSpace(fieldNode.Text()), 10, 8)
+			if err != nil {
+				tools.LogAndPanic(log, "Invalid view priority", "view", viewHash["id"], "error", err)
+			}
+			viewHash[name] = priority
+			continue
+		}
 		if len(fieldNode.ChildElements()) > 0 {
 			fieldType := fieldNode.SelectAttrValue("type", "text")
 			switch fieldType {
@@ -186,5 +206,8 @@ func LoadViewFromEtree(element *etree.Element) {
 	if err := json.Unmarshal(bytes, &view); err != nil {
 		tools.LogAndPanic(log, "Unable to unmarshal view", "viewHash", viewHash, "error", err)
 	}
+	view.Module = module
+	view.File = file
+	view.inheritRef = inheritRef
 	ViewsRegistry.AddView(&view)
 }
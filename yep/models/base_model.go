@@ -26,6 +26,7 @@ import (
 
 const (
 	TRANSIENT_MODEL Option = 1 << iota
+	HIERARCHICAL_MODEL
 )
 
 type BaseModel struct {
@@ -41,6 +42,13 @@ type BaseTransientModel struct {
 	ID int64 `orm:"column(id)"`
 }
 
+// HierarchicalModel holds the fields added to models created with the
+// HIERARCHICAL_MODEL option. ParentPath is maintained by the ORM and holds
+// the ids of the ancestors of the record followed by its own id, e.g. "1/5/12/".
+type HierarchicalModel struct {
+	ParentPath string `yep:"nocopy"`
+}
+
 func declareBaseMethods(name string) {
 	DeclareMethod(name, "ComputeWriteDate", ComputeWriteDate)
 	DeclareMethod(name, "ComputeNameGet", ComputeNameGet)
@@ -57,10 +65,12 @@ func declareBaseMethods(name string) {
 	DeclareMethod(name, "FieldsGet", FieldsGet)
 	DeclareMethod(name, "ProcessView", ProcessView)
 	DeclareMethod(name, "AddModifiers", AddModifiers)
+	DeclareMethod(name, "AddOnchanges", AddOnchanges)
 	DeclareMethod(name, "UpdateFieldNames", UpdateFieldNames)
 	DeclareMethod(name, "SearchRead", SearchRead)
 	DeclareMethod(name, "DefaultGet", DefaultGet)
 	DeclareMethod(name, "Onchange", Onchange)
+	DeclareMethod(name, "Load", Load)
 }
 
 /*
@@ -241,6 +251,7 @@ type FieldsViewGetParams struct {
 	ViewID   string `json:"view_id"`
 	ViewType string `json:"view_type"`
 	Toolbar  bool   `json:"toolbar"`
+	ActionID string `json:"action_id"`
 }
 
 // Return type string for the FieldsViewGet function
@@ -253,6 +264,7 @@ type FieldsViewData struct {
 	Fields      map[string]*FieldInfo `json:"fields"`
 	Toolbar     ir.Toolbar            `json:"toolbar"`
 	FieldParent string                `json:"field_parent"`
+	Filters     []*IrFilter           `json:"filters,omitempty"`
 }
 
 // Exportable field information struct
@@ -273,12 +285,15 @@ type FieldInfo struct {
 	String           string                 `json:"string"`
 	Domain           Domain                 `json:"domain"`
 	Relation         string                 `json:"relation"`
+	Selection        Selection              `json:"selection,omitempty"`
+	Digits           *tools.Digits          `json:"digits,omitempty"`
+	CurrencyField    string                 `json:"currency_field,omitempty"`
 }
 
 /*
 FieldsViewGet is the base implementation of the 'FieldsViewGet' method which
 gets the detailed composition of the requested view like fields, model,
-view architecture.
+view architecture. Search views also get the filters saved by the user.
 */
 func FieldsViewGet(rs RecordSet, args FieldsViewGetParams) *FieldsViewData {
 	view := ir.ViewsRegistry.GetViewById(args.ViewID)
@@ -303,6 +318,13 @@ func FieldsViewGet(rs RecordSet, args FieldsViewGetParams) *FieldsViewData {
 		Type:   view.Type,
 		Fields: fInfos,
 	}
+	if view.Type == ir.VIEW_TYPE_SEARCH {
+		// Add the saved filters for the favorites menu
+		res.Filters = rs.Env().Pool("IrFilters").Call("GetFilters", GetFiltersParams{
+			Model:    rs.ModelName(),
+			ActionID: args.ActionID,
+		}).([]*IrFilter)
+	}
 	return &res
 }
 
@@ -319,6 +341,7 @@ func ProcessView(rs RecordSet, arch string, fieldInfos map[string]*FieldInfo) st
 	// Apply changes
 	rs.Call("UpdateFieldNames", doc)
 	rs.Call("AddModifiers", doc, fieldInfos)
+	rs.Call("AddOnchanges", doc)
 	// Dump xml to string and return
 	res, err := doc.WriteToString()
 	if err != nil {
@@ -342,6 +365,21 @@ func AddModifiers(rs RecordSet, doc *etree.Document, fieldInfos map[string]*Fiel
 	}
 }
 
+/*
+AddOnchanges adds the on_change attribute to the fields of the given xml doc
+whose changes must be sent to the server through the 'Onchange' method.
+*/
+func AddOnchanges(rs RecordSet, doc *etree.Document) {
+	for _, fieldTag := range doc.FindElements("//field") {
+		fieldName := fieldTag.SelectAttr("name").Value
+		fi, ok := rs.mi.fields.get(fieldName)
+		if !ok || !fi.triggersOnchange() {
+			continue
+		}
+		fieldTag.CreateAttr("on_change", "1")
+	}
+}
+
 /*
 UpdateFieldNames changes the field names in the view to the column names.
 If a field name is already column names then it does nothing.
@@ -357,7 +395,11 @@ func UpdateFieldNames(rs RecordSet, doc *etree.Document) {
 		fieldTag.CreateAttr("name", fi.json)
 	}
 	for _, labelTag := range doc.FindElements("//label") {
-		fieldName := labelTag.SelectAttr("for").Value
+		fieldName := labelTag.SelectAttrValue("for", "")
+		if fieldName == "" {
+			// Labels with a string only
+			continue
+		}
 		fi, ok := rs.mi.fields.get(fieldName)
 		if !ok {
 			tools.LogAndPanic(log, "Unknown field in model", "field", fieldName, "model", rs.mi.name)
@@ -376,7 +418,8 @@ type FieldsGetArgs struct {
 /*
 FieldsGet returns the definition of each field.
 The _inherits'd fields are included.
-TODO The string, help, and selection (if present) attributes are translated.
+The selection labels (if present) are translated in the language of the context.
+TODO The string and help attributes are translated.
 */
 func FieldsGet(rs RecordSet, args FieldsGetArgs) map[string]*FieldInfo {
 	res := make(map[string]*FieldInfo)
@@ -398,15 +441,31 @@ func FieldsGet(rs RecordSet, args FieldsGetArgs) map[string]*FieldInfo {
 		if fInfo.relatedModel != nil {
 			relation = fInfo.relatedModel.name
 		}
+		var (
+			digits        *tools.Digits
+			currencyField string
+		)
+		switch {
+		case fInfo.fieldType == tools.MONETARY:
+			digits = rs.contextMonetaryDigits(fInfo)
+			currencyFI, _ := rs.mi.fields.get(fInfo.currencyField)
+			currencyField = currencyFI.json
+		case fInfo.digits != tools.Digits{}:
+			digits = &tools.Digits{fInfo.digits[0], fInfo.digits[1]}
+		}
 		res[fInfo.json] = &FieldInfo{
-			Help:       fInfo.help,
-			Searchable: true,
-			Depends:    fInfo.depends,
-			Sortable:   true,
-			Type:       fInfo.fieldType,
-			Store:      fInfo.stored,
-			String:     fInfo.description,
-			Relation:   relation,
+			Help:          fInfo.help,
+			Searchable:    true,
+			Depends:       fInfo.depends,
+			Sortable:      true,
+			Type:          fInfo.fieldType,
+			Store:         fInfo.stored,
+			ReadOnly:      fInfo.readOnly,
+			String:        fInfo.description,
+			Relation:      relation,
+			Selection:     rs.translatedSelectionOf(fInfo),
+			Digits:        digits,
+			CurrencyField: currencyField,
 		}
 	}
 	return res
@@ -458,10 +517,127 @@ type OnchangeParams struct {
 	Onchange map[string]string `json:"field_onchange"`
 }
 
+// OnchangeWarning is a warning message to display to the user
+// after an onchange.
+type OnchangeWarning struct {
+	Title   string `json:"title"`
+	Message string `json:"message"`
+}
+
+// OnchangeResult is the return type of the Onchange method and of the
+// methods given in the 'onchange' struct tag of fields.
+// - Value holds the new values of the record fields
+// - Warning is an optional message to display to the user
+// - Domain holds new domains to apply to relation fields
+type OnchangeResult struct {
+	Value   FieldMap          `json:"value"`
+	Warning *OnchangeWarning  `json:"warning,omitempty"`
+	Domain  map[string]Domain `json:"domain"`
+}
+
 /*
 Onchange returns the values that must be modified in the pseudo-record given as params.Values
+
+The onchange methods of the fields given in params.Fields are called on a
+pseudo-record built from params.Values and the computed and related fields of
+the pseudo-record are evaluated again. Nothing is saved in the database.
 */
-func Onchange(rs RecordSet, params OnchangeParams) FieldMap {
-	// TODO Implement Onchange
-	return make(FieldMap)
+func Onchange(rs RecordSet, params OnchangeParams) OnchangeResult {
+	res := OnchangeResult{
+		Value:  make(FieldMap),
+		Domain: make(map[string]Domain),
+	}
+	rs.withPseudoRecord(params.Values, func(rec *RecordSet) {
+		rec.computeOnchange(params, &res)
+	})
+	return res
+}
+
+// computeOnchange calls on this pseudo-record the onchange methods of the
+// fields given in params and reads again its computed fields into res.
+func (rs RecordSet) computeOnchange(params OnchangeParams, res *OnchangeResult) {
+	var warnings []string
+	for _, fName := range params.Fields {
+		fi, ok := rs.mi.fields.get(fName)
+		if !ok || fi.onchange == "" {
+			continue
+		}
+		fRes := rs.Call(fi.onchange).(OnchangeResult)
+		if len(fRes.Value) > 0 {
+			rs.writePseudoRecordValues(rs.pseudoRecordValues(fRes.Value, false))
+			for k, v := range fRes.Value {
+				res.Value[rs.mi.getRelatedFieldInfo(k).json] = v
+			}
+		}
+		if fRes.Warning != nil {
+			warnings = append(warnings, fRes.Warning.Message)
+			if res.Warning == nil {
+				res.Warning = &OnchangeWarning{Title: fRes.Warning.Title}
+			}
+		}
+		for k, dom := range fRes.Domain {
+			res.Domain[rs.mi.getRelatedFieldInfo(k).json] = dom
+		}
+	}
+	if len(warnings) > 0 {
+		res.Warning.Message = strings.Join(warnings, "\n\n")
+	}
+
+	// Evaluate again computed and related fields
+	var fields []string
+	for jName, fi := range rs.mi.fields.registryByJSON {
+		if !fi.computed() && !fi.related() {
+			continue
+		}
+		if _, inView := params.Onchange[jName]; len(params.Onchange) > 0 && !inView {
+			continue
+		}
+		fields = append(fields, jName)
+	}
+	if len(fields) > 0 {
+		vals := rs.Call("Read", fields).([]FieldMap)[0]
+		for _, f := range fields {
+			if _, exists := res.Value[f]; !exists {
+				res.Value[f] = vals[f]
+			}
+		}
+	}
+}
+
+// LoadParams is the args struct for the Load function
+type LoadParams struct {
+	// Fields are the column names of Data, which can be:
+	// - 'id' for the external IDs of the records,
+	// - a field name or JSON name,
+	// - a relational field followed by '/id' or ':id' for values given by
+	// external IDs, or by '/.id' for values given by database ids.
+	Fields []string `json:"fields"`
+	// Data is the list of rows of values to load, as strings.
+	Data [][]string `json:"data"`
+	// Module is the module of the external IDs given without module.
+	Module string `json:"module"`
+	// NoUpdate is set on the created external IDs.
+	NoUpdate bool `json:"noupdate"`
+}
+
+/*
+Load is the base implementation of the 'Load' method which creates or
+updates records from rows of string values, such as the lines of a CSV file.
+
+Records of rows with an external ID are created or updated by their external
+ID, the others are created. Values of relational fields given without '/id'
+or '/.id' suffix are searched by name. Values of one2many and many2many
+fields are comma separated lists of records that are linked to the loaded
+record. The many2many links of the loaded record are replaced by the given
+records.
+
+It returns the loaded records and panics if a row cannot be loaded.
+*/
+func Load(rs RecordSet, params LoadParams) *RecordSet {
+	columns := rs.loadColumns(params.Fields)
+	ids := make([]int64, len(params.Data))
+	for i, row := range params.Data {
+		ids[i] = rs.loadRow(columns, row, params.Module, params.NoUpdate).ID()
+	}
+	return rs.withIds(ids)
 }
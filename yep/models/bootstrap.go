@@ -17,6 +17,8 @@ package models
 import (
 	"fmt"
 	"reflect"
+	"sort"
+	"strings"
 
 	"github.com/npiganeau/yep/yep/tools"
 )
@@ -33,11 +35,15 @@ func BootStrap() {
 	modelRegistry.bootstrapped = true
 
 	createModelLinks()
+	resolveReverseFKs()
 	inflateInherits()
 	syncRelatedFieldInfo()
 	syncDatabase()
 	bootStrapMethods()
 	processDepends()
+	checkFieldMethods()
+	checkMonetaryFields()
+	checkHierarchicalModels()
 }
 
 // createModelLinks create links with related modelInfo
@@ -72,11 +78,68 @@ func createModelLinks() {
 				}
 			}
 			fi.relatedModel = relatedMI
+			if fi.fieldType == tools.MANY2MANY {
+				setM2MRelation(fi)
+			}
 		}
 		mi.fields.bootstrapped = true
 	}
 }
 
+// setM2MRelation sets the link table of the given many2many field and its
+// columns pointing to the field's model and to the related model. The link
+// table is shared by the many2many fields of both models pointing to each
+// other.
+func setM2MRelation(fi *fieldInfo) {
+	ourTable, theirTable := fi.mi.tableName, fi.relatedModel.tableName
+	tables := []string{ourTable, theirTable}
+	sort.Strings(tables)
+	fi.m2mRelTable = fmt.Sprintf("%s_%s_rel", tables[0], tables[1])
+	fi.m2mOurField = fmt.Sprintf("%s_id", ourTable)
+	fi.m2mTheirField = fmt.Sprintf("%s_id", theirTable)
+	if ourTable == theirTable {
+		fi.m2mRelTable = fmt.Sprintf("%s_%s_rel", ourTable, fi.json)
+		fi.m2mOurField = fmt.Sprintf("%s1_id", ourTable)
+		fi.m2mTheirField = fmt.Sprintf("%s2_id", ourTable)
+	}
+}
+
+// resolveReverseFKs sets the reverseFK of one2many and rev2one fields to the
+// json name of the many2one or one2one field of the related model that points
+// back to the field's model. This field is given by the 'fk' tag or, if it is
+// not set, is the only field of the related model pointing to our model.
+//
+// Fields whose foreign key cannot be found are only logged here, so that
+// the error is raised when they are actually used as reverse fields.
+func resolveReverseFKs() {
+	for _, mi := range modelRegistry.registryByName {
+		for _, fi := range mi.fields.registryByName {
+			if !fi.isReverse() {
+				continue
+			}
+			var candidates []*fieldInfo
+			for _, relFI := range fi.relatedModel.fields.registryByName {
+				if relFI.fieldType != tools.MANY2ONE && relFI.fieldType != tools.ONE2ONE {
+					continue
+				}
+				if relFI.relatedModel != mi || relFI.related() {
+					continue
+				}
+				if fi.reverseFK != "" && fi.reverseFK != relFI.name && fi.reverseFK != relFI.json {
+					continue
+				}
+				candidates = append(candidates, relFI)
+			}
+			if len(candidates) != 1 {
+				log.Warn("Unable to find the foreign key of reverse field, set the 'fk' tag", "model", mi.name, "field", fi.name, "fk", fi.reverseFK, "candidates", len(candidates))
+				fi.reverseFK = ""
+				continue
+			}
+			fi.reverseFK = candidates[0].json
+		}
+	}
+}
+
 // inflateInherits creates related fields for all fields of related-inherits-ed
 // models.
 func inflateInherits() {
@@ -137,9 +200,22 @@ func syncDatabase() {
 		}
 		updateDBColumns(mi)
 		updateDBIndexes(mi)
+		if mi.isHierarchical() {
+			fillParentPaths(mi)
+		}
+	}
+	// Create many2many link tables
+	relTables := m2mRelTables()
+	for relTable, fi := range relTables {
+		if _, ok := dbTables[relTable]; !ok {
+			createM2MRelTable(fi)
+		}
 	}
 	// Drop DB tables that are not in the models
 	for dbTable := range adapter.tables() {
+		if _, ok := relTables[dbTable]; ok {
+			continue
+		}
 		var modelExists bool
 		for tableName := range modelRegistry.registryByTableName {
 			if dbTable != tableName {
@@ -166,6 +242,37 @@ func createDBTable(tableName string) {
 	dbExecuteNoTx(query)
 }
 
+// m2mRelTables returns the link tables of all many2many fields, each with
+// one of the fields using it.
+func m2mRelTables() map[string]*fieldInfo {
+	res := make(map[string]*fieldInfo)
+	for _, mi := range modelRegistry.registryByName {
+		for _, fi := range mi.fields.registryByName {
+			if fi.fieldType == tools.MANY2MANY {
+				res[fi.m2mRelTable] = fi
+			}
+		}
+	}
+	return res
+}
+
+// createM2MRelTable creates the link table of the given many2many field.
+// Links are deleted with the records they point to.
+func createM2MRelTable(fi *fieldInfo) {
+	adapter := adapters[db.DriverName()]
+	query := fmt.Sprintf(`
+	CREATE TABLE %s (
+		%s integer NOT NULL REFERENCES %s (id) ON DELETE CASCADE,
+		%s integer NOT NULL REFERENCES %s (id) ON DELETE CASCADE,
+		PRIMARY KEY (%s, %s)
+	)
+	`, adapter.quoteTableName(fi.m2mRelTable),
+		fi.m2mOurField, adapter.quoteTableName(fi.mi.tableName),
+		fi.m2mTheirField, adapter.quoteTableName(fi.relatedModel.tableName),
+		fi.m2mOurField, fi.m2mTheirField)
+	dbExecuteNoTx(query)
+}
+
 // dropDBTable drops the given table in the database
 func dropDBTable(tableName string) {
 	adapter := adapters[db.DriverName()]
@@ -288,6 +395,34 @@ func updateDBIndexes(mi *modelInfo) {
 			createColumnIndex(mi.tableName, colName)
 		}
 	}
+	// parent path index for prefix queries
+	if mi.isHierarchical() {
+		if !adapter.indexExists(mi.tableName, fmt.Sprintf("%s_%s_index", mi.tableName, parentPathField)) {
+			createParentPathIndex(mi.tableName)
+		}
+	}
+	// unique constraints on several columns
+	for _, colNames := range mi.uniques {
+		if !adapter.indexExists(mi.tableName, uniqueIndexName(mi.tableName, colNames)) {
+			createUniqueIndex(mi.tableName, colNames)
+		}
+	}
+}
+
+// uniqueIndexName returns the name of the unique index on the given
+// columns of the given table.
+func uniqueIndexName(tableName string, colNames []string) string {
+	return fmt.Sprintf("%s_%s_unique", tableName, strings.Join(colNames, "_"))
+}
+
+// createUniqueIndex creates a unique index on the given columns of the
+// given table.
+func createUniqueIndex(tableName string, colNames []string) {
+	adapter := adapters[db.DriverName()]
+	query := fmt.Sprintf(`
+		CREATE UNIQUE INDEX %s ON %s (%s)
+	`, uniqueIndexName(tableName, colNames), adapter.quoteTableName(tableName), strings.Join(colNames, ", "))
+	dbExecuteNoTx(query)
 }
 
 // createIndex creates an column index for colName in the given table
@@ -299,9 +434,115 @@ func createColumnIndex(tableName, colName string) {
 	dbExecuteNoTx(query)
 }
 
+// createParentPathIndex creates an index on the parent path column of the
+// given table that can be used by LIKE prefix queries.
+func createParentPathIndex(tableName string) {
+	adapter := adapters[db.DriverName()]
+	query := fmt.Sprintf(`
+		CREATE INDEX %s ON %s (%s varchar_pattern_ops)
+	`, fmt.Sprintf("%s_%s_index", tableName, parentPathField), adapter.quoteTableName(tableName), parentPathField)
+	dbExecuteNoTx(query)
+}
+
+// fillParentPaths computes the parent path of the records of the given
+// hierarchical model that have none, such as the records created before
+// the model became hierarchical. The paths of all the records are computed
+// from the roots of the hierarchy with a recursive query.
+func fillParentPaths(mi *modelInfo) {
+	adapter := adapters[db.DriverName()]
+	table := adapter.quoteTableName(mi.tableName)
+	var count int64
+	dbGetNoTx(&count, fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE %s = ''`, table, parentPathField))
+	if count == 0 {
+		return
+	}
+	log.Info("Computing parent paths", "model", mi.name, "records", count)
+	dbExecuteNoTx(fmt.Sprintf(`
+		WITH RECURSIVE paths(id, path) AS (
+			SELECT id, id || '%[4]s' FROM %[1]s WHERE %[3]s IS NULL
+			UNION ALL
+			SELECT c.id, p.path || c.id || '%[4]s' FROM %[1]s c JOIN paths p ON c.%[3]s = p.id
+		)
+		UPDATE %[1]s t SET %[2]s = paths.path
+		FROM paths WHERE t.id = paths.id AND t.%[2]s <> paths.path
+	`, table, parentPathField, parentField, parentPathSep))
+}
+
 // bootStrapMethods freezes the methods of the models.
 func bootStrapMethods() {
 	for _, mi := range modelRegistry.registryByName {
 		mi.methods.bootstrapped = true
 	}
 }
+
+// checkFieldMethods panics if a field refers to an onchange or a selection
+// method that has not been declared on its model, if these methods do not
+// return an OnchangeResult or a Selection, or if a reference field targets an
+// unknown model.
+func checkFieldMethods() {
+	for _, mi := range modelRegistry.registryByName {
+		for _, fi := range mi.fields.registryByName {
+			if fi.onchange != "" {
+				methInfo, ok := mi.methods.get(fi.onchange)
+				if !ok {
+					tools.LogAndPanic(log, "Unknown onchange method in model", "model", mi.name, "field", fi.name, "method", fi.onchange)
+				}
+				mType := methInfo.methodType
+				if mType.NumIn() != 1 || mType.NumOut() != 1 || mType.Out(0) != reflect.TypeOf(OnchangeResult{}) {
+					tools.LogAndPanic(log, "Onchange methods must have no arguments and return an OnchangeResult", "model", mi.name, "field", fi.name, "method", fi.onchange, "type", mType)
+				}
+			}
+			if fi.selectionFunc != "" {
+				methInfo, ok := mi.methods.get(fi.selectionFunc)
+				if !ok {
+					tools.LogAndPanic(log, "Unknown selection method in model", "model", mi.name, "field", fi.name, "method", fi.selectionFunc)
+				}
+				mType := methInfo.methodType
+				if mType.NumIn() != 1 || mType.NumOut() != 1 || mType.Out(0) != reflect.TypeOf(Selection{}) {
+					tools.LogAndPanic(log, "Selection methods must have no arguments and return a Selection", "model", mi.name, "field", fi.name, "method", fi.selectionFunc, "type", mType)
+				}
+			}
+			for _, refModel := range fi.refModels {
+				if _, ok := modelRegistry.get(refModel); !ok {
+					tools.LogAndPanic(log, "Unknown model in reference field", "model", mi.name, "field", fi.name, "refModel", refModel)
+				}
+			}
+		}
+	}
+}
+
+// checkMonetaryFields panics if a monetary field is not a Decimal or does
+// not refer to a valid currency field.
+func checkMonetaryFields() {
+	for _, mi := range modelRegistry.registryByName {
+		for _, fi := range mi.fields.registryByName {
+			if fi.fieldType != tools.MONETARY {
+				continue
+			}
+			if fi.structField.Type != reflect.TypeOf(Decimal{}) {
+				tools.LogAndPanic(log, "Monetary fields must be of type Decimal", "model", mi.name, "field", fi.name)
+			}
+			currencyFI, ok := mi.fields.get(fi.currencyField)
+			if !ok || currencyFI.fieldType != tools.MANY2ONE {
+				tools.LogAndPanic(log, "Currency field of monetary field must be a many2one field of the same model", "model", mi.name, "field", fi.name, "currencyField", fi.currencyField)
+			}
+			if _, ok := currencyFI.relatedModel.fields.get(currencyScaleField); !ok {
+				tools.LogAndPanic(log, "Currency model has no decimal places field", "model", mi.name, "field", fi.name, "currencyModel", currencyFI.relatedModel.name, "expected", currencyScaleField)
+			}
+		}
+	}
+}
+
+// checkHierarchicalModels panics if a hierarchical model has no 'Parent'
+// many2one field pointing to itself.
+func checkHierarchicalModels() {
+	for _, mi := range modelRegistry.registryByName {
+		if !mi.isHierarchical() {
+			continue
+		}
+		parentFI, ok := mi.fields.get(parentField)
+		if !ok || parentFI.fieldType != tools.MANY2ONE || parentFI.relatedModel != mi {
+			tools.LogAndPanic(log, "Hierarchical models must have a Parent many2one field to themselves", "model", mi.name)
+		}
+	}
+}
@@ -51,13 +51,16 @@ func NewCondition() *Condition {
 // checkArgs check expressions, operator and args and panics if
 // they are not valid
 func checkArgs(expr, op string, arg interface{}) {
-	if expr == "" || op == "" || arg == nil {
+	if expr == "" || op == "" {
 		tools.LogAndPanic(log, "Condition arguments cannot empty", "expr", expr, "operator", op, "arg", arg)
 	}
 	dop := DomainOperator(op)
 	if !allowedOperators[dop] {
 		tools.LogAndPanic(log, "Unknown operator", "operator", op)
 	}
+	if arg == nil && !nullableOperators[dop] {
+		tools.LogAndPanic(log, "Operator cannot be used with a nil argument", "expr", expr, "operator", op)
+	}
 }
 
 // And add expression to condition
@@ -132,6 +135,30 @@ func (c *Condition) OrCond(cond *Condition) *Condition {
 	return c
 }
 
+// AndNotCond combine a NOT condition to current condition
+func (c *Condition) AndNotCond(cond *Condition) *Condition {
+	c = c.clone()
+	if c == cond {
+		tools.LogAndPanic(log, "Cannot use self as sub condition", "condition", c)
+	}
+	if cond != nil {
+		c.params = append(c.params, condValue{cond: cond, isCond: true, isNot: true})
+	}
+	return c
+}
+
+// OrNotCond combine a OR NOT condition to current condition
+func (c *Condition) OrNotCond(cond *Condition) *Condition {
+	c = c.clone()
+	if c == cond {
+		tools.LogAndPanic(log, "Cannot use self as sub condition", "condition", c)
+	}
+	if cond != nil {
+		c.params = append(c.params, condValue{cond: cond, isCond: true, isOr: true, isNot: true})
+	}
+	return c
+}
+
 // IsEmpty check the condition arguments are empty or not.
 func (c *Condition) IsEmpty() bool {
 	return len(c.params) == 0
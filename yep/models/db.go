@@ -28,8 +28,14 @@ var (
 )
 
 type dbAdapter interface {
-	// operatorSQL returns the sql string and placeholders for the given DomainOperator
-	operatorSQL(DomainOperator, interface{}) (string, interface{})
+	// operatorSQL returns the sql clause and its parameters comparing the given
+	// field SQL expression of the given fieldInfo to arg with the given DomainOperator
+	operatorSQL(field string, op DomainOperator, fi *fieldInfo, arg interface{}) (string, SQLParams)
+	// jsonPathSQL returns the SQL operator to extract the value at the given path from a JSON column
+	jsonPathSQL(keys []string, asText bool) string
+	// jsonNumericSQL returns the SQL expression of the given JSON value as a number,
+	// or NULL if it is not a JSON number
+	jsonNumericSQL(jsonExpr string) string
 	// typeSQL returns the SQL type string, including columns constraints if any
 	typeSQL(fi *fieldInfo) string
 	// columnSQLDefinition returns the SQL type string, including columns constraints if any
@@ -124,3 +130,17 @@ func DBQuery(cr *sqlx.Tx, query string, args ...interface{}) *sqlx.Rows {
 	logCtx.Debug("Query executed")
 	return rows
 }
+
+// DBSelect is a wrapper around sqlx.Select
+// It gets the value of all the rows found by the given query and arguments
+// It panics in case of error
+func DBSelect(cr *sqlx.Tx, dest interface{}, query string, args ...interface{}) {
+	query = cr.Rebind(query)
+	t := time.Now()
+	err := cr.Select(dest, query, args...)
+	logCtx := log.New("query", query, "args", args, "duration", time.Now().Sub(t))
+	if err != nil {
+		tools.LogAndPanic(logCtx, "Error while executing query", "error", err)
+	}
+	logCtx.Debug("Query executed")
+}
@@ -16,6 +16,8 @@ package models
 
 import (
 	"fmt"
+	"reflect"
+	"strings"
 
 	"database/sql"
 	"github.com/npiganeau/yep/yep/tools"
@@ -35,10 +37,14 @@ var pgOperators = map[DomainOperator]string{
 	OPERATOR_IN:            "IN (?)",
 	OPERATOR_NOT_IN:        "NOT IN (?)",
 	OPERATOR_LOWER:         "< ?",
-	OPERATOR_LOWER_EQUAL:   "< ?",
+	OPERATOR_LOWER_EQUAL:   "<= ?",
 	OPERATOR_GREATER:       "> ?",
 	OPERATOR_GREATER_EQUAL: ">= ?",
-	//OPERATOR_CHILD_OF: "",
+	OPERATOR_BETWEEN:       "BETWEEN ? AND ?",
+	OPERATOR_REGEX:         "~ ?",
+	OPERATOR_NOT_REGEX:     "!~ ?",
+	OPERATOR_IREGEX:        "~* ?",
+	OPERATOR_NOT_IREGEX:    "!~* ?",
 }
 
 var pgTypes = map[tools.FieldType]string{
@@ -52,9 +58,12 @@ var pgTypes = map[tools.FieldType]string{
 	tools.HTML:      "text",
 	tools.BINARY:    "bytea",
 	tools.SELECTION: "varchar",
-	//tools.REFERENCE: "varchar",
-	tools.MANY2ONE: "integer",
-	tools.ONE2ONE:  "integer",
+	tools.REFERENCE: "varchar",
+	tools.MONETARY:  "numeric",
+	tools.JSON:      "jsonb",
+	tools.IMAGE:     "varchar",
+	tools.MANY2ONE:  "integer",
+	tools.ONE2ONE:   "integer",
 }
 
 var pgDefaultValues = map[tools.FieldType]string{
@@ -68,42 +77,188 @@ var pgDefaultValues = map[tools.FieldType]string{
 	tools.HTML:      "''",
 	tools.BINARY:    "''",
 	tools.SELECTION: "''",
-	//tools.REFERENCE: "''",
+	tools.REFERENCE: "''",
+	tools.MONETARY:  "0",
+	tools.IMAGE:     "''",
 }
 
-// operatorSQL returns the sql string and placeholders for the given DomainOperator
-// Also modifies the given args to match the syntax of the operator.
-func (d *postgresAdapter) operatorSQL(do DomainOperator, arg interface{}) (string, interface{}) {
-	op := pgOperators[do]
+// operatorSQL returns the sql clause and its parameters comparing the given
+// field SQL expression of the given fieldInfo to arg with the given DomainOperator.
+//
+// - false values are considered as NULL, except for boolean fields
+// - '=' and '!=' with NULL compile to IS NULL and IS NOT NULL
+// - on NOT NULL columns, NULL also stands for the default value of the type
+// - '!=' and 'not in' also match NULL values of nullable columns
+// - '=?' always matches if arg is NULL, and behaves as '=' otherwise
+// - 'in' and 'not in' accept empty lists, lists with NULL and subqueries
+// - 'like', 'ilike' and their negations wrap arg with '%'; '=like' and '=ilike' don't
+// - 'has_key' matches the keys of JSON objects and the strings of JSON arrays
+func (d *postgresAdapter) operatorSQL(field string, do DomainOperator, fi *fieldInfo, arg interface{}) (string, SQLParams) {
+	if b, ok := arg.(bool); ok && !b && fi.fieldType != tools.BOOLEAN {
+		// The client sends false for empty values
+		arg = nil
+	}
+	switch do {
+	case OPERATOR_UNSET_EQUALS:
+		if isNullArg(arg) {
+			return "TRUE", nil
+		}
+		do = OPERATOR_EQUALS
+	case OPERATOR_IN, OPERATOR_NOT_IN:
+		return d.inOperatorSQL(field, do, fi, arg)
+	case OPERATOR_HAS_KEY:
+		// jsonb_exists is the ? operator, which matches both the keys of
+		// objects and the string elements of arrays
+		return fmt.Sprintf("jsonb_exists(%s, ?)", field), SQLParams{arg}
+	case OPERATOR_BETWEEN:
+		bounds := reflect.ValueOf(arg)
+		if bounds.Kind() != reflect.Slice || bounds.Len() != 2 {
+			tools.LogAndPanic(log, "Argument of between operator must be a slice of 2 values", "field", field, "arg", arg)
+		}
+		return fmt.Sprintf("%s %s", field, pgOperators[do]), SQLParams{bounds.Index(0).Interface(), bounds.Index(1).Interface()}
+	}
+	if isNullArg(arg) {
+		switch do {
+		case OPERATOR_EQUALS:
+			return d.nullSQL(field, fi), nil
+		case OPERATOR_NOT_EQUALS:
+			return d.notNullSQL(field, fi), nil
+		}
+		tools.LogAndPanic(log, "Operator cannot be used with a null value", "field", field, "operator", do)
+	}
 	switch do {
 	case OPERATOR_LIKE, OPERATOR_ILIKE, OPERATOR_NOT_LIKE, OPERATOR_NOT_ILIKE:
 		arg = fmt.Sprintf("%%%s%%", arg)
 	}
-	return op, arg
+	if ref, ok := arg.(Reference); ok && ref.ModelName() != "" && ref.ID() == 0 {
+		// A reference without id matches all the records of the model
+		switch do {
+		case OPERATOR_EQUALS:
+			do = OPERATOR_LIKE_PATTERN
+			arg = fmt.Sprintf("%s,%%", ref.ModelName())
+		case OPERATOR_NOT_EQUALS:
+			do = OPERATOR_NOT_LIKE
+			arg = fmt.Sprintf("%s,%%", ref.ModelName())
+		}
+	}
+	op, ok := pgOperators[do]
+	if !ok {
+		tools.LogAndPanic(log, "Operator not supported by database adapter", "operator", do, "field", field)
+	}
+	if do == OPERATOR_NOT_EQUALS && !d.fieldIsNotNull(fi) {
+		return fmt.Sprintf("(%s %s OR %s IS NULL)", field, op, field), SQLParams{arg}
+	}
+	return fmt.Sprintf("%s %s", field, op), SQLParams{arg}
+}
+
+// inOperatorSQL returns the sql clause and its parameters of an 'in'
+// or 'not in' condition. arg can be a subquery, a single value or a
+// slice of values, which may be empty or include NULL values.
+func (d *postgresAdapter) inOperatorSQL(field string, do DomainOperator, fi *fieldInfo, arg interface{}) (string, SQLParams) {
+	if sub, ok := arg.(sqlSubquery); ok {
+		subSQL := fmt.Sprintf("%s %s", field, strings.Replace(pgOperators[do], "?", sub.sql, 1))
+		if do == OPERATOR_NOT_IN && !d.fieldIsNotNull(fi) {
+			subSQL = fmt.Sprintf("(%s OR %s IS NULL)", subSQL, field)
+		}
+		return subSQL, sub.args
+	}
+	var (
+		values  []interface{}
+		hasNull bool
+	)
+	argVal := reflect.ValueOf(arg)
+	if argVal.Kind() == reflect.Slice && argVal.Type().Elem().Kind() != reflect.Uint8 {
+		for i := 0; i < argVal.Len(); i++ {
+			values = append(values, argVal.Index(i).Interface())
+		}
+	} else {
+		values = []interface{}{arg}
+	}
+	var nonNullValues []interface{}
+	for _, value := range values {
+		if b, ok := value.(bool); (ok && !b && fi.fieldType != tools.BOOLEAN) || isNullArg(value) {
+			hasNull = true
+			continue
+		}
+		nonNullValues = append(nonNullValues, value)
+	}
+	var (
+		clauses []string
+		args    SQLParams
+	)
+	if len(nonNullValues) > 0 {
+		clauses = append(clauses, fmt.Sprintf("%s %s", field, pgOperators[do]))
+		args = append(args, nonNullValues)
+	}
+	sep := " OR "
+	switch {
+	case do == OPERATOR_IN && hasNull:
+		clauses = append(clauses, d.nullSQL(field, fi))
+	case do == OPERATOR_NOT_IN && hasNull:
+		clauses = append(clauses, d.notNullSQL(field, fi))
+		sep = " AND "
+	case do == OPERATOR_NOT_IN && len(clauses) > 0 && !d.fieldIsNotNull(fi):
+		clauses = append(clauses, fmt.Sprintf("%s IS NULL", field))
+	}
+	switch len(clauses) {
+	case 0:
+		if do == OPERATOR_IN {
+			return "FALSE", nil
+		}
+		return "TRUE", nil
+	case 1:
+		return clauses[0], args
+	}
+	return fmt.Sprintf("(%s)", strings.Join(clauses, sep)), args
+}
+
+// nullSQL returns the SQL clause matching the empty values of the given
+// field SQL expression. NOT NULL columns hold the default value of their
+// type when empty, and may still be NULL through a LEFT JOIN.
+func (d *postgresAdapter) nullSQL(field string, fi *fieldInfo) string {
+	defValue, ok := pgDefaultValues[fi.fieldType]
+	if !ok || !d.fieldIsNotNull(fi) {
+		return fmt.Sprintf("%s IS NULL", field)
+	}
+	return fmt.Sprintf("(%s IS NULL OR %s = %s)", field, field, defValue)
+}
+
+// notNullSQL returns the SQL clause matching the non empty values of the
+// given field SQL expression. It is the negation of nullSQL.
+func (d *postgresAdapter) notNullSQL(field string, fi *fieldInfo) string {
+	defValue, ok := pgDefaultValues[fi.fieldType]
+	if !ok || !d.fieldIsNotNull(fi) {
+		return fmt.Sprintf("%s IS NOT NULL", field)
+	}
+	return fmt.Sprintf("(%s IS NOT NULL AND %s != %s)", field, field, defValue)
 }
 
 // typeSQL returns the sql type string for the given fieldInfo
 func (d *postgresAdapter) typeSQL(fi *fieldInfo) string {
+	switch {
+	case fi.fieldType == tools.FLOAT && (fi.digits != (tools.Digits{}) || fi.isDecimal()):
+		return "numeric"
+	case fi.fieldType == tools.BINARY && fi.attachment:
+		// Attachments are stored in the filestore, we only keep their checksum
+		return "varchar"
+	}
 	typ, _ := pgTypes[fi.fieldType]
 	return typ
 }
 
 // columnSQLDefinition returns the SQL type string, including columns constraints if any
 func (d *postgresAdapter) columnSQLDefinition(fi *fieldInfo) string {
-	var res string
-	typ, ok := pgTypes[fi.fieldType]
-	res = typ
-	if !ok {
+	if _, ok := pgTypes[fi.fieldType]; !ok {
 		tools.LogAndPanic(log, "Unknown column type", "type", fi.fieldType, "model", fi.mi.name, "field", fi.name)
 	}
+	res := d.typeSQL(fi)
 	switch fi.fieldType {
 	case tools.CHAR:
 		if fi.size > 0 {
 			res = fmt.Sprintf("%s(%d)", res, fi.size)
 		}
 	case tools.FLOAT:
-		emptyD := tools.Digits{}
-		if fi.digits != emptyD {
+		if fi.digits != (tools.Digits{}) {
 			res = fmt.Sprintf("numeric(%d, %d)", (fi.digits)[0], (fi.digits)[1])
 		}
 	}
@@ -123,9 +278,10 @@ func (d *postgresAdapter) columnSQLDefinition(fi *fieldInfo) string {
 }
 
 // fieldIsNull returns true if the given fieldInfo results in a
-// NOT NULL column in database.
+// NOT NULL column in database. Relation and JSON columns are nullable
+// unless the field is required.
 func (d *postgresAdapter) fieldIsNotNull(fi *fieldInfo) bool {
-	if fi.fieldType == tools.MANY2ONE || fi.fieldType == tools.ONE2ONE {
+	if fi.fieldType == tools.MANY2ONE || fi.fieldType == tools.ONE2ONE || fi.fieldType == tools.JSON {
 		if fi.required {
 			return true
 		}
@@ -136,7 +292,11 @@ func (d *postgresAdapter) fieldIsNotNull(fi *fieldInfo) bool {
 }
 
 // fieldSQLDefault returns the SQL default value of the fieldInfo
+// Active fields default to TRUE so that new records are not archived.
 func (d *postgresAdapter) fieldSQLDefault(fi *fieldInfo) string {
+	if fi.json == activeField && fi.fieldType == tools.BOOLEAN {
+		return "TRUE"
+	}
 	return pgDefaultValues[fi.fieldType]
 }
 
@@ -154,6 +314,34 @@ func (d *postgresAdapter) tables() map[string]bool {
 	return res
 }
 
+// jsonPathSQL returns the SQL operator to extract the value at the given
+// path of keys from a jsonb column, e.g. ` #>> '{"address","city"}'`.
+// If asText is true, the value is extracted as text, otherwise as jsonb.
+func (d *postgresAdapter) jsonPathSQL(keys []string, asText bool) string {
+	if len(keys) == 0 {
+		return ""
+	}
+	op := "#>"
+	if asText {
+		op = "#>>"
+	}
+	quotedKeys := make([]string, len(keys))
+	for i, key := range keys {
+		key = strings.Replace(key, `\`, `\\`, -1)
+		key = strings.Replace(key, `"`, `\"`, -1)
+		quotedKeys[i] = fmt.Sprintf(`"%s"`, key)
+	}
+	path := strings.Replace(strings.Join(quotedKeys, ","), "'", "''", -1)
+	return fmt.Sprintf(" %s '{%s}'", op, path)
+}
+
+// jsonNumericSQL returns the SQL expression of the given jsonb value as a
+// numeric, or NULL if it is not a JSON number, so that numbers inside JSON
+// fields are not compared as text.
+func (d *postgresAdapter) jsonNumericSQL(jsonExpr string) string {
+	return fmt.Sprintf("(CASE WHEN jsonb_typeof(%s) = 'number' THEN (%s)::text::numeric END)", jsonExpr, jsonExpr)
+}
+
 // quoteTableName returns the given table name with sql quotes
 func (d *postgresAdapter) quoteTableName(tableName string) string {
 	return fmt.Sprintf(`"%s"`, tableName)
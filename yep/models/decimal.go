@@ -0,0 +1,310 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Decimal is an exact decimal number made of an arbitrary precision
+// integer coefficient and a scale, i.e. the number of digits to the right
+// of the decimal point. Its value is coefficient * 10^(-scale).
+//
+// Decimal values are immutable. The zero value is 0.
+type Decimal struct {
+	coefficient *big.Int
+	scale       int32
+}
+
+// NewDecimal returns the Decimal coefficient * 10^(-scale).
+func NewDecimal(coefficient int64, scale int32) Decimal {
+	if scale < 0 {
+		return Decimal{coefficient: new(big.Int).Mul(big.NewInt(coefficient), pow10(-scale))}
+	}
+	return Decimal{coefficient: big.NewInt(coefficient), scale: scale}
+}
+
+// NewDecimalFromFloat returns the Decimal with the shortest representation
+// that converts back to f.
+func NewDecimalFromFloat(f float64) Decimal {
+	d, err := ParseDecimal(strconv.FormatFloat(f, 'f', -1, 64))
+	if err != nil {
+		// Only NaN and infinities can get here
+		return Decimal{}
+	}
+	return d
+}
+
+// ParseDecimal returns the Decimal represented by the given string,
+// such as "-12.345" or "1.5e-3".
+func ParseDecimal(str string) (Decimal, error) {
+	s := strings.TrimSpace(str)
+	var exp int64
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		var err error
+		exp, err = strconv.ParseInt(s[i+1:], 10, 32)
+		if err != nil {
+			return Decimal{}, fmt.Errorf("Invalid exponent in decimal '%s'", str)
+		}
+		s = s[:i]
+	}
+	var negative bool
+	switch {
+	case strings.HasPrefix(s, "-"):
+		negative = true
+		s = s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+	intPart, fracPart := s, ""
+	if i := strings.Index(s, "."); i >= 0 {
+		intPart, fracPart = s[:i], s[i+1:]
+	}
+	digits := intPart + fracPart
+	if digits == "" {
+		return Decimal{}, fmt.Errorf("Invalid decimal '%s'", str)
+	}
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return Decimal{}, fmt.Errorf("Invalid decimal '%s'", str)
+		}
+	}
+	coef, _ := new(big.Int).SetString(digits, 10)
+	if negative {
+		coef.Neg(coef)
+	}
+	scale := int64(len(fracPart)) - exp
+	if scale < 0 {
+		return Decimal{coefficient: coef.Mul(coef, pow10(int32(-scale)))}, nil
+	}
+	return Decimal{coefficient: coef, scale: int32(scale)}, nil
+}
+
+// pow10 returns 10^n as a new big.Int
+func pow10(n int32) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// coef returns the coefficient of d, taking care of the zero value.
+// The returned value must not be modified.
+func (d Decimal) coef() *big.Int {
+	if d.coefficient == nil {
+		return new(big.Int)
+	}
+	return d.coefficient
+}
+
+// Scale returns the number of digits to the right of the decimal point of d
+func (d Decimal) Scale() int32 {
+	return d.scale
+}
+
+// IsZero returns true if d equals 0
+func (d Decimal) IsZero() bool {
+	return d.coef().Sign() == 0
+}
+
+// Sign returns -1, 0 or +1 depending on whether d is negative, zero or positive.
+func (d Decimal) Sign() int {
+	return d.coef().Sign()
+}
+
+// rescale returns the coefficients of d and other expressed with the
+// same scale, which is returned as well.
+func (d Decimal) rescale(other Decimal) (*big.Int, *big.Int, int32) {
+	switch {
+	case d.scale > other.scale:
+		return d.coef(), new(big.Int).Mul(other.coef(), pow10(d.scale-other.scale)), d.scale
+	case d.scale < other.scale:
+		return new(big.Int).Mul(d.coef(), pow10(other.scale-d.scale)), other.coef(), other.scale
+	}
+	return d.coef(), other.coef(), d.scale
+}
+
+// Add returns d + other
+func (d Decimal) Add(other Decimal) Decimal {
+	c1, c2, scale := d.rescale(other)
+	return Decimal{coefficient: new(big.Int).Add(c1, c2), scale: scale}
+}
+
+// Sub returns d - other
+func (d Decimal) Sub(other Decimal) Decimal {
+	c1, c2, scale := d.rescale(other)
+	return Decimal{coefficient: new(big.Int).Sub(c1, c2), scale: scale}
+}
+
+// Mul returns d * other. The scale of the result is the sum of the scales
+// of d and other, so that no precision is lost.
+func (d Decimal) Mul(other Decimal) Decimal {
+	return Decimal{coefficient: new(big.Int).Mul(d.coef(), other.coef()), scale: d.scale + other.scale}
+}
+
+// Div returns d / other rounded to the given number of digits to the right
+// of the decimal point. It panics if other is zero.
+func (d Decimal) Div(other Decimal, places int32) Decimal {
+	if other.IsZero() {
+		panic("Decimal division by zero")
+	}
+	// We compute the quotient with one more digit than needed and let
+	// Round do the rounding. The truncation error is below this digit,
+	// except for exact halves that are then correctly rounded away from zero.
+	shift := places + 1 + other.scale - d.scale
+	num := new(big.Int).Set(d.coef())
+	den := new(big.Int).Set(other.coef())
+	if shift >= 0 {
+		num.Mul(num, pow10(shift))
+	} else {
+		den.Mul(den, pow10(-shift))
+	}
+	quo := new(big.Int).Quo(num, den)
+	return Decimal{coefficient: quo, scale: places + 1}.Round(places)
+}
+
+// Neg returns -d
+func (d Decimal) Neg() Decimal {
+	return Decimal{coefficient: new(big.Int).Neg(d.coef()), scale: d.scale}
+}
+
+// Abs returns the absolute value of d
+func (d Decimal) Abs() Decimal {
+	return Decimal{coefficient: new(big.Int).Abs(d.coef()), scale: d.scale}
+}
+
+// Cmp compares d and other and returns -1 if d < other, 0 if d == other
+// and +1 if d > other.
+func (d Decimal) Cmp(other Decimal) int {
+	c1, c2, _ := d.rescale(other)
+	return c1.Cmp(c2)
+}
+
+// Equal returns true if d and other have the same value, whatever their scale.
+func (d Decimal) Equal(other Decimal) bool {
+	return d.Cmp(other) == 0
+}
+
+// Round returns d rounded to the given number of digits to the right of
+// the decimal point. Halves are rounded away from zero, as PostgreSQL does.
+// If d has less digits than places, the returned Decimal is padded with zeros.
+// Negative places round to the left of the decimal point, e.g. -2 rounds to
+// hundreds, and give a Decimal with a scale of 0.
+func (d Decimal) Round(places int32) Decimal {
+	if places >= d.scale {
+		coef := new(big.Int).Mul(d.coef(), pow10(places-d.scale))
+		return Decimal{coefficient: coef, scale: places}
+	}
+	divisor := pow10(d.scale - places)
+	quo, rem := new(big.Int).QuoRem(new(big.Int).Abs(d.coef()), divisor, new(big.Int))
+	if rem.Lsh(rem, 1).Cmp(divisor) >= 0 {
+		quo.Add(quo, big.NewInt(1))
+	}
+	if d.Sign() < 0 {
+		quo.Neg(quo)
+	}
+	if places < 0 {
+		return Decimal{coefficient: quo.Mul(quo, pow10(-places))}
+	}
+	return Decimal{coefficient: quo, scale: places}
+}
+
+// String returns the representation of d with all its scale digits,
+// such as "-12.50".
+func (d Decimal) String() string {
+	digits := new(big.Int).Abs(d.coef()).String()
+	var sign string
+	if d.Sign() < 0 {
+		sign = "-"
+	}
+	if d.scale <= 0 {
+		return sign + digits + strings.Repeat("0", int(-d.scale))
+	}
+	if len(digits) <= int(d.scale) {
+		digits = strings.Repeat("0", int(d.scale)-len(digits)+1) + digits
+	}
+	point := len(digits) - int(d.scale)
+	return fmt.Sprintf("%s%s.%s", sign, digits[:point], digits[point:])
+}
+
+// StringFixed returns the representation of d rounded to the given
+// number of digits to the right of the decimal point.
+func (d Decimal) StringFixed(places int32) string {
+	return d.Round(places).String()
+}
+
+// Float64 returns the nearest float64 value of d
+func (d Decimal) Float64() float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
+
+// Value formats our Decimal for storing in database.
+func (d Decimal) Value() (driver.Value, error) {
+	return driver.Value(d.String()), nil
+}
+
+// Scan implements sql.Scanner for Decimal. It accepts strings,
+// integers, floats and Decimal values.
+func (d *Decimal) Scan(src interface{}) error {
+	switch val := src.(type) {
+	case nil:
+		*d = Decimal{}
+	case Decimal:
+		*d = val
+	case []byte:
+		return d.parse(string(val))
+	case string:
+		return d.parse(val)
+	case int:
+		*d = NewDecimal(int64(val), 0)
+	case int64:
+		*d = NewDecimal(val, 0)
+	case float32:
+		*d = NewDecimalFromFloat(float64(val))
+	case float64:
+		*d = NewDecimalFromFloat(val)
+	default:
+		return fmt.Errorf("Unable to scan %v (%T) into a Decimal", src, src)
+	}
+	return nil
+}
+
+// parse sets d to the Decimal represented by str.
+func (d *Decimal) parse(str string) error {
+	res, err := ParseDecimal(str)
+	if err != nil {
+		return err
+	}
+	*d = res
+	return nil
+}
+
+// MarshalJSON for Decimal type. Decimals are marshaled as JSON numbers.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalJSON for Decimal type. Both JSON numbers and strings are accepted.
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	str := string(data)
+	switch str {
+	case "null", "false":
+		*d = Decimal{}
+		return nil
+	}
+	return d.parse(strings.Trim(str, `"`))
+}
@@ -14,7 +14,12 @@
 
 package models
 
-import "github.com/npiganeau/yep/yep/tools"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/npiganeau/yep/yep/tools"
+)
 
 /*
 Domain is a list of search criteria (DomainTerm) in the form of a tuplet (field_name, operator, value).
@@ -51,6 +56,16 @@ const (
 	OPERATOR_IN            DomainOperator = "in"
 	OPERATOR_NOT_IN        DomainOperator = "not in"
 	OPERATOR_CHILD_OF      DomainOperator = "child_of"
+	OPERATOR_NOT_CHILD_OF  DomainOperator = "not child_of"
+	OPERATOR_PARENT_OF     DomainOperator = "parent_of"
+	OPERATOR_BETWEEN       DomainOperator = "between"
+	OPERATOR_REGEX         DomainOperator = "=~"
+	OPERATOR_NOT_REGEX     DomainOperator = "!~"
+	OPERATOR_IREGEX        DomainOperator = "=~*"
+	OPERATOR_NOT_IREGEX    DomainOperator = "!~*"
+	OPERATOR_HAS_KEY       DomainOperator = "has_key"
+	OPERATOR_ANY           DomainOperator = "any"
+	OPERATOR_NOT_ANY       DomainOperator = "not any"
 )
 
 var allowedOperators = map[DomainOperator]bool{
@@ -70,6 +85,25 @@ var allowedOperators = map[DomainOperator]bool{
 	OPERATOR_IN:            true,
 	OPERATOR_NOT_IN:        true,
 	OPERATOR_CHILD_OF:      true,
+	OPERATOR_NOT_CHILD_OF:  true,
+	OPERATOR_PARENT_OF:     true,
+	OPERATOR_BETWEEN:       true,
+	OPERATOR_REGEX:         true,
+	OPERATOR_NOT_REGEX:     true,
+	OPERATOR_IREGEX:        true,
+	OPERATOR_NOT_IREGEX:    true,
+	OPERATOR_HAS_KEY:       true,
+	OPERATOR_ANY:           true,
+	OPERATOR_NOT_ANY:       true,
+}
+
+// nullableOperators are the operators that accept a nil argument
+var nullableOperators = map[DomainOperator]bool{
+	OPERATOR_EQUALS:       true,
+	OPERATOR_NOT_EQUALS:   true,
+	OPERATOR_UNSET_EQUALS: true,
+	OPERATOR_IN:           true,
+	OPERATOR_NOT_IN:       true,
 }
 
 // ParseDomain gets an Odoo domain and parses it into a RecordSet query Condition.
@@ -85,6 +119,17 @@ func ParseDomain(dom Domain) *Condition {
 	return res
 }
 
+// EvalDomain evaluates the given Odoo-style Python domain string, such as
+// "[('user_id', '=', uid)]", with the variables of env and returns it as a Domain.
+// It panics if the string cannot be evaluated to a list.
+func EvalDomain(src string, env tools.PyEnv) Domain {
+	res, err := tools.EvalPyList(src, env)
+	if err != nil {
+		tools.LogAndPanic(log, "Unable to evaluate domain", "domain", src, "error", err)
+	}
+	return Domain(res)
+}
+
 // parseDomain is the internal recursive function making all the job of
 // ParseDomain. The given domain through pointer is deleted during operation.
 func parseDomain(dom *Domain) *Condition {
@@ -100,9 +145,23 @@ func parseDomain(dom *Domain) *Condition {
 	if ftStr, ok := operatorTerm.(string); ok {
 		currentOp = DomainPrefixOperator(ftStr)
 		*dom = (*dom)[1:]
+		if len(*dom) == 0 {
+			tools.LogAndPanic(log, "Missing operand in domain", "operator", currentOp)
+		}
 		firstTerm = (*dom)[0]
 	}
 
+	if currentOp == PREFIX_NOT {
+		// '!' is unary, so we negate a single term or included condition
+		switch ft := firstTerm.(type) {
+		case string:
+			return res.AndNotCond(parseDomain(dom))
+		case []interface{}:
+			*dom = (*dom)[1:]
+			return addTerm(res, DomainTerm(ft), PREFIX_NOT)
+		}
+	}
+
 	switch ft := firstTerm.(type) {
 	case string:
 		// We have a unary operator '|' or '&', so this is an included condition
@@ -163,8 +222,201 @@ func getConditionMethod(cond *Condition, op DomainPrefixOperator) func(string, s
 		return cond.And
 	case PREFIX_OR:
 		return cond.Or
+	case PREFIX_NOT:
+		return cond.AndNot
 	default:
 		tools.LogAndPanic(log, "Unknown prefix operator", "operator", op)
 	}
 	return nil
 }
+
+// domainNodeType is the type of a node of a domainNode tree
+type domainNodeType int
+
+const (
+	leafNode domainNodeType = iota
+	andNode
+	orNode
+	notNode
+)
+
+// A domainNode is a node of the boolean expression tree of a Condition.
+// It is used to normalize conditions before serializing them.
+type domainNode struct {
+	typ      domainNodeType
+	children []*domainNode
+	leaf     condValue
+}
+
+// invertedOperators maps operators to their exact negation when they are
+// applied to a single field. Operators such as '=' are not inverted because
+// a condition through an x2many field with '!=' is not the negation of '='.
+var invertedOperators = map[DomainOperator]DomainOperator{
+	OPERATOR_ANY:     OPERATOR_NOT_ANY,
+	OPERATOR_NOT_ANY: OPERATOR_ANY,
+}
+
+// domainTree returns the expression tree of this Condition.
+// Terms are evaluated as in SQL, i.e. AND takes precedence over OR.
+func (c Condition) domainTree() *domainNode {
+	res := &domainNode{typ: orNode}
+	var group *domainNode
+	for i, cv := range c.params {
+		if i == 0 || cv.isOr {
+			group = &domainNode{typ: andNode}
+			res.children = append(res.children, group)
+		}
+		node := &domainNode{typ: leafNode, leaf: cv}
+		if cv.isCond {
+			node = cv.cond.domainTree()
+		}
+		if cv.isNot {
+			node = &domainNode{typ: notNode, children: []*domainNode{node}}
+		}
+		group.children = append(group.children, node)
+	}
+	return res
+}
+
+// normalize returns a new tree equivalent to this one (or to its negation if
+// negate is true) where NOT nodes are only applied to leaves, nested nodes of
+// the same type are flattened and nodes with a single child are replaced by
+// this child. It returns nil if the tree is empty.
+func (n *domainNode) normalize(negate bool) *domainNode {
+	switch n.typ {
+	case leafNode:
+		if !negate {
+			return n
+		}
+		if invOp, ok := invertedOperators[n.leaf.operator]; ok && len(n.leaf.exprs) == 1 {
+			leaf := n.leaf
+			leaf.operator = invOp
+			return &domainNode{typ: leafNode, leaf: leaf}
+		}
+		return &domainNode{typ: notNode, children: []*domainNode{n}}
+	case notNode:
+		return n.children[0].normalize(!negate)
+	}
+	typ := n.typ
+	if negate {
+		// De Morgan's laws
+		typ = andNode
+		if n.typ == andNode {
+			typ = orNode
+		}
+	}
+	res := &domainNode{typ: typ}
+	for _, child := range n.children {
+		normChild := child.normalize(negate)
+		switch {
+		case normChild == nil:
+			continue
+		case normChild.typ == typ:
+			res.children = append(res.children, normChild.children...)
+		default:
+			res.children = append(res.children, normChild)
+		}
+	}
+	switch len(res.children) {
+	case 0:
+		return nil
+	case 1:
+		return res.children[0]
+	}
+	return res
+}
+
+// domain returns the domain in prefix notation of this node. Field paths
+// are given with the JSON names of the fields of the given model.
+func (n *domainNode) domain(mi *modelInfo) Domain {
+	var res Domain
+	switch n.typ {
+	case leafNode:
+		path := strings.Join(n.leaf.exprs, ExprSep)
+		arg := n.leaf.arg
+		if cond, ok := arg.(*Condition); ok {
+			arg = cond.domain(mi.getRelatedModelInfo(path))
+		}
+		return Domain{[]interface{}{strings.Join(jsonizeExpr(mi, n.leaf.exprs), ExprSep), string(n.leaf.operator), arg}}
+	case notNode:
+		res = append(res, string(PREFIX_NOT))
+	default:
+		op := PREFIX_AND
+		if n.typ == orNode {
+			op = PREFIX_OR
+		}
+		for i := 1; i < len(n.children); i++ {
+			res = append(res, string(op))
+		}
+	}
+	for _, child := range n.children {
+		res = append(res, child.domain(mi)...)
+	}
+	return res
+}
+
+// String returns a human readable representation of this node
+func (n *domainNode) String() string {
+	switch n.typ {
+	case leafNode:
+		var arg string
+		switch a := n.leaf.arg.(type) {
+		case string:
+			arg = fmt.Sprintf("%q", a)
+		case *Condition:
+			arg = fmt.Sprintf("(%s)", a)
+		default:
+			arg = fmt.Sprintf("%v", a)
+		}
+		return fmt.Sprintf("%s %s %s", strings.Join(n.leaf.exprs, ExprSep), n.leaf.operator, arg)
+	case notNode:
+		if n.children[0].typ == leafNode {
+			return fmt.Sprintf("NOT %s", n.children[0])
+		}
+		return fmt.Sprintf("NOT (%s)", n.children[0])
+	}
+	sep := " AND "
+	if n.typ == orNode {
+		sep = " OR "
+	}
+	items := make([]string, len(n.children))
+	for i, child := range n.children {
+		items[i] = child.String()
+		if child.typ == andNode || child.typ == orNode {
+			items[i] = fmt.Sprintf("(%s)", items[i])
+		}
+	}
+	return strings.Join(items, sep)
+}
+
+// Domain returns the normalized domain in prefix notation of this Condition
+// on the given model. Nested ANDs and ORs are flattened and NOT operators are
+// pushed down to the terms. Field paths are given with the JSON names of the
+// fields, so that the returned domain can be sent to the client or parsed
+// back with ParseDomain. It returns an empty Domain if the condition is empty.
+func (c Condition) Domain(modelName string) Domain {
+	mi, ok := modelRegistry.get(modelName)
+	if !ok {
+		tools.LogAndPanic(log, "Unknown model", "model", modelName)
+	}
+	return c.domain(mi)
+}
+
+// domain returns the normalized domain of this Condition on the given model.
+func (c Condition) domain(mi *modelInfo) Domain {
+	tree := c.domainTree().normalize(false)
+	if tree == nil {
+		return Domain{}
+	}
+	return tree.domain(mi)
+}
+
+// String returns a human readable representation of this Condition, such as
+// `user_name = "John" AND (age > 18 OR NOT is_staff = true)`.
+func (c Condition) String() string {
+	tree := c.domainTree().normalize(false)
+	if tree == nil {
+		return ""
+	}
+	return tree.String()
+}
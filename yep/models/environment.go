@@ -91,6 +91,20 @@ func (env Environment) Create(data interface{}) *RecordSet {
 	return rs
 }
 
+// ResolveReference returns a RecordSet on the record pointed to by ref.
+// The returned RecordSet is empty if ref has no id.
+// It panics if ref has no model.
+func (env Environment) ResolveReference(ref Reference) *RecordSet {
+	if ref.ModelName() == "" {
+		tools.LogAndPanic(log, "Unable to resolve a reference without model", "reference", ref)
+	}
+	rs := env.Pool(ref.ModelName())
+	if ref.ID() == 0 {
+		return rs
+	}
+	return rs.withIds([]int64{ref.ID()})
+}
+
 // Sync writes the given data to database.
 // data must be a struct pointer that has been originally populated by RecordSet.ReadOne()
 // or in a batch by RecordSet.ReadAll().
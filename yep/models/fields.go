@@ -15,6 +15,7 @@
 package models
 
 import (
+	"fmt"
 	"reflect"
 	"strconv"
 	"strings"
@@ -176,6 +177,19 @@ type fieldInfo struct {
 	dependencies  []computeData
 	inherits      bool
 	noCopy        bool
+	onchange      string
+	selection     Selection
+	selectionFunc string
+	selectionAdd  Selection
+	refModels     []string
+	currencyField string
+	attachment    bool
+	imageSizes    []int
+	readOnly      bool
+	reverseFK     string
+	m2mRelTable   string
+	m2mOurField   string
+	m2mTheirField string
 }
 
 // computed returns true if this field is computed
@@ -183,6 +197,22 @@ func (fi *fieldInfo) computed() bool {
 	return fi.compute != ""
 }
 
+// isReverse returns true if the values of this field are given by a
+// foreign key on the table of the related model.
+func (fi *fieldInfo) isReverse() bool {
+	return fi.fieldType == tools.ONE2MANY || fi.fieldType == tools.REV2ONE
+}
+
+// foreignKey returns the json name of the field of the related model that
+// points back to this reverse field. It panics if it could not be resolved
+// at bootstrap.
+func (fi *fieldInfo) foreignKey() string {
+	if fi.reverseFK == "" {
+		tools.LogAndPanic(log, "Unable to find the foreign key of reverse field, set the 'fk' tag", "model", fi.mi.name, "field", fi.name)
+	}
+	return fi.reverseFK
+}
+
 // related returns true if this field is related
 func (fi *fieldInfo) related() bool {
 	return fi.relatedPath != ""
@@ -219,8 +249,10 @@ func createFieldInfo(sf reflect.StructField, mi *modelInfo) *fieldInfo {
 	_, index := attrs["index"]
 	_, inherits := attrs["inherits"]
 	_, noCopy := attrs["nocopy"]
+	_, attachment := attrs["attachment"]
 
 	computeName := tags["compute"]
+	onchange := tags["onchange"]
 	relatedPath := tags["related"]
 	sStr, _ := tags["size"]
 	size, _ := strconv.Atoi(sStr)
@@ -243,10 +275,52 @@ func createFieldInfo(sf reflect.StructField, mi *modelInfo) *fieldInfo {
 		desc = sf.Name
 	}
 
+	var selection, selectionAdd Selection
+	if sTag, ok := tags["selection"]; ok {
+		selection = parseSelectionTag(sTag)
+	}
+	if sTag, ok := tags["selection_add"]; ok {
+		selectionAdd = parseSelectionTag(sTag)
+		// Fields first declared with selection_add only have the added options
+		selection = selection.Extend(selectionAdd)
+	}
+	selectionFunc := tags["selection_func"]
+	currencyField := tags["currency_field"]
+
+	var refModels []string
+	if refModelsTag, ok := tags["models"]; ok {
+		for _, refModel := range strings.Split(refModelsTag, defaultTagDataDelim) {
+			refModels = append(refModels, strings.TrimSpace(refModel))
+		}
+	}
+
 	typStr, ok := tags["type"]
 	typ := tools.FieldType(typStr)
 	if !ok {
 		typ = getFieldType(sf.Type)
+		if selection != nil || selectionAdd != nil || selectionFunc != "" {
+			typ = tools.SELECTION
+		}
+		if currencyField != "" {
+			typ = tools.MONETARY
+		}
+		if attachment {
+			typ = tools.BINARY
+		}
+	}
+	if typ == tools.IMAGE {
+		// Images are always stored as attachments
+		attachment = true
+	}
+	var imageSizes []int
+	if sizesTag, ok := tags["sizes"]; ok {
+		for _, sizeStr := range strings.Split(sizesTag, defaultTagDataDelim) {
+			imageSize, err := strconv.Atoi(strings.TrimSpace(sizeStr))
+			if err != nil || imageSize <= 0 {
+				tools.LogAndPanic(log, "Invalid image size in struct tag", "model", mi.name, "field", sf.Name, "size", sizeStr)
+			}
+			imageSizes = append(imageSizes, imageSize)
+		}
 	}
 
 	if inherits && typ != tools.MANY2ONE && typ != tools.ONE2ONE {
@@ -290,10 +364,70 @@ func createFieldInfo(sf reflect.StructField, mi *modelInfo) *fieldInfo {
 		relatedPath:   relatedPath,
 		inherits:      inherits,
 		noCopy:        noCopy,
+		onchange:      onchange,
+		selection:     selection,
+		selectionFunc: selectionFunc,
+		selectionAdd:  selectionAdd,
+		refModels:     refModels,
+		currencyField: currencyField,
+		attachment:    attachment,
+		imageSizes:    imageSizes,
+		reverseFK:     tags["fk"],
 	}
 	return &fInfo
 }
 
+// imageVariantFieldInfos returns the read-only fields holding the resized
+// variants of this image field, one per size given in the 'sizes' tag.
+// Variant fields are named after the image field and the size, such as
+// Image128 (image_128).
+func (fi *fieldInfo) imageVariantFieldInfos() []*fieldInfo {
+	res := make([]*fieldInfo, len(fi.imageSizes))
+	for i, imageSize := range fi.imageSizes {
+		name := fmt.Sprintf("%s%d", fi.name, imageSize)
+		res[i] = &fieldInfo{
+			mi:          fi.mi,
+			name:        name,
+			json:        fi.imageVariantJSON(imageSize),
+			description: fmt.Sprintf("%s (%dpx)", fi.description, imageSize),
+			fieldType:   tools.IMAGE,
+			structField: reflect.StructField{Name: name, Type: fi.structField.Type},
+			attachment:  true,
+			readOnly:    true,
+			noCopy:      true,
+		}
+	}
+	return res
+}
+
+// imageVariantJSON returns the JSON name of the variant of this image
+// field of the given size.
+func (fi *fieldInfo) imageVariantJSON(imageSize int) string {
+	return fmt.Sprintf("%s_%d", fi.json, imageSize)
+}
+
+// isDecimal returns true if this field holds its values as Decimal
+func (fi *fieldInfo) isDecimal() bool {
+	return fi.structField.Type == reflect.TypeOf(Decimal{})
+}
+
+// parseSelectionTag returns the Selection defined by the given 'selection'
+// struct tag value, such as "draft|Draft,done|Done". Items without label
+// get their key as label.
+func parseSelectionTag(tag string) Selection {
+	var res Selection
+	for _, item := range strings.Split(tag, defaultTagDataDelim) {
+		tokens := strings.SplitN(item, selectionLabelDelim, 2)
+		key := strings.TrimSpace(tokens[0])
+		label := key
+		if len(tokens) > 1 {
+			label = strings.TrimSpace(tokens[1])
+		}
+		res = append(res, [2]string{key, label})
+	}
+	return res
+}
+
 /*
 processDepends populates the dependencies of each fieldInfo from the depends strings of
 each fieldInfo instances.
@@ -17,6 +17,7 @@ package models
 import (
 	"github.com/inconshreveable/log15"
 	"github.com/jmoiron/sqlx"
+	"github.com/npiganeau/yep/yep/ir"
 	"github.com/npiganeau/yep/yep/tools"
 )
 
@@ -30,4 +31,10 @@ func init() {
 	registerDBAdapter("postgres", new(postgresAdapter))
 	// model registry
 	modelRegistry = newModelCollection()
+	// built-in models
+	createIrFiltersModel()
+	createIrModelDataModel()
+	createIrModuleModel()
+	// views validation
+	ir.RegisterViewValidator(validateView)
 }
@@ -0,0 +1,161 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"strings"
+
+	"github.com/npiganeau/yep/yep/tools"
+)
+
+// IrFilter holds the data of a search filter saved by a user for a
+// model and optionally an action.
+//
+// A filter with a zero UserID is shared with all users. At most one
+// filter per user, model and action can be the default filter.
+type IrFilter struct {
+	ID        int64         `json:"id"`
+	Name      string        `yep:"required" json:"name"`
+	UserID    int64         `yep:"index" json:"user_id"`
+	ModelID   string        `yep:"required;index" json:"model_id"`
+	ActionID  string        `json:"action_id"`
+	Domain    Domain        `yep:"type(json)" json:"domain"`
+	Context   tools.Context `json:"context"`
+	Sort      string        `json:"sort"`
+	IsDefault bool          `json:"is_default"`
+	Active    bool          `json:"active"`
+}
+
+// createIrFiltersModel creates the IrFilters model which stores the
+// filters saved by users in the favorites menu of the search views.
+func createIrFiltersModel() {
+	CreateModel("IrFilters")
+	ExtendModel("IrFilters", new(IrFilter))
+	DeclareMethod("IrFilters", "GetFilters", GetFilters)
+	DeclareMethod("IrFilters", "CreateOrReplace", CreateOrReplace)
+}
+
+// GetFiltersParams is the args struct for the GetFilters function
+type GetFiltersParams struct {
+	Model    string `json:"model"`
+	ActionID string `json:"action_id"`
+}
+
+/*
+GetFilters returns the filters of the given model that are available to
+the current user: its own filters and the shared ones. Filters bound to
+another action than the given one are not returned.
+*/
+func GetFilters(rs RecordSet, params GetFiltersParams) []*IrFilter {
+	userCond := NewCondition().And("UserID", "=", rs.Env().Uid()).Or("UserID", "=", 0)
+	actionCond := NewCondition().And("ActionID", "=", "")
+	if params.ActionID != "" {
+		actionCond = actionCond.Or("ActionID", "=", params.ActionID)
+	}
+	var filters []*IrFilter
+	rs.Env().Pool("IrFilters").
+		Filter("ModelID", "=", tools.ConvertModelName(params.Model)).
+		Condition(userCond).
+		Condition(actionCond).
+		OrderBy("Name").
+		ReadAll(&filters)
+	return filters
+}
+
+/*
+CreateOrReplace saves the filter given by vals and returns it.
+
+The filter replaces the filter of the same owner, model and action whose
+name matches case-insensitively, if any. Otherwise a new filter is created.
+If the filter is saved as default, the other filters of the same owner,
+model and action are not default anymore.
+*/
+func CreateOrReplace(rs RecordSet, vals FieldMap) *RecordSet {
+	filter := irFilterValues(rs.Env(), vals)
+	if filter["Name"] == "" || filter["ModelID"] == "" {
+		tools.LogAndPanic(log, "Filters must have a name and a model", "values", vals)
+	}
+	sameScope := rs.Env().Pool("IrFilters").
+		Filter("ModelID", "=", filter["ModelID"]).
+		Filter("ActionID", "=", filter["ActionID"]).
+		Filter("UserID", "=", filter["UserID"])
+
+	namePattern := escapeLikePattern(filter["Name"].(string))
+	if filter["IsDefault"] == true {
+		sameScope.Filter("IsDefault", "=", true).
+			Exclude("Name", "=ilike", namePattern).
+			Write(FieldMap{"IsDefault": false})
+	}
+	existing := sameScope.Filter("Name", "=ilike", namePattern).Limit(1).Search()
+	if len(existing.Ids()) > 0 {
+		existing.Call("Write", filter)
+		return existing
+	}
+	return rs.Env().Pool("IrFilters").Call("Create", filter).(*RecordSet)
+}
+
+// escapeLikePattern returns the given string escaped to be matched literally
+// by the 'like' operators, in which '%' and '_' are wildcards.
+func escapeLikePattern(s string) string {
+	return likePatternReplacer.Replace(s)
+}
+
+// likePatternReplacer escapes the special characters of 'like' patterns
+var likePatternReplacer = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// irFilterValues returns a FieldMap of IrFilters field values from the
+// given client values, which are given by JSON names with Odoo conventions.
+//
+// Client model names are converted to YEP model names, and false user or
+// action ids are converted to zero values. If no user is given, the filter
+// is private to the user of env.
+func irFilterValues(env *Environment, vals FieldMap) FieldMap {
+	res := FieldMap{
+		"Name":     strings.TrimSpace(stringValue(vals["name"])),
+		"ModelID":  tools.ConvertModelName(stringValue(vals["model_id"])),
+		"ActionID": stringValue(vals["action_id"]),
+		"UserID":   env.Uid(),
+	}
+	if userID, ok := vals["user_id"]; ok {
+		switch uid := userID.(type) {
+		case float64:
+			res["UserID"] = int64(uid)
+		case int64:
+			res["UserID"] = uid
+		default:
+			res["UserID"] = int64(0)
+		}
+	}
+	if domain, ok := vals["domain"]; ok && domain != nil {
+		res["Domain"] = domain
+	}
+	if context, ok := vals["context"]; ok && context != nil {
+		res["Context"] = context
+	}
+	if sort, ok := vals["sort"]; ok {
+		res["Sort"] = stringValue(sort)
+	}
+	if isDefault, ok := vals["is_default"].(bool); ok {
+		res["IsDefault"] = isDefault
+	}
+	return res
+}
+
+// stringValue returns the given client value if it is a string and an
+// empty string otherwise, such as when the client sends false.
+func stringValue(value interface{}) string {
+	str, _ := value.(string)
+	return str
+}
@@ -0,0 +1,156 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"strings"
+
+	"github.com/npiganeau/yep/yep/tools"
+)
+
+// IrModelData maps an external ID, given as "module.name", to a database
+// record given by its model and id.
+//
+// External IDs give a stable identifier to the records created by the
+// data files of the modules, so that they can be updated by later loads
+// of the same files and referenced from other modules.
+type IrModelData struct {
+	ID       int64
+	Module   string `yep:"required;index"`
+	Name     string `yep:"required;index"`
+	Model    string `yep:"required"`
+	ResID    int64
+	NoUpdate bool
+}
+
+// createIrModelDataModel creates the IrModelData model which stores the
+// external IDs of the records. External IDs are unique in the database.
+func createIrModelDataModel() {
+	CreateModel("IrModelData")
+	ExtendModel("IrModelData", new(IrModelData))
+	mi, _ := modelRegistry.get("IrModelData")
+	mi.uniques = append(mi.uniques, []string{"module", "name"})
+}
+
+// splitXMLID returns the module and the name of the given external ID.
+// It panics if xmlID is not of the form "module.name".
+func splitXMLID(xmlID string) (string, string) {
+	tokens := strings.SplitN(xmlID, ".", 2)
+	if len(tokens) != 2 || tokens[0] == "" || tokens[1] == "" {
+		tools.LogAndPanic(log, "External IDs must be of the form 'module.name'", "xml_id", xmlID)
+	}
+	return tokens[0], tokens[1]
+}
+
+// fullXMLID returns the given external ID prefixed by the given
+// module if it has no module yet.
+func fullXMLID(module, xmlID string) string {
+	if strings.Contains(xmlID, ".") {
+		return xmlID
+	}
+	return module + "." + xmlID
+}
+
+// modelData returns the IrModelData of the given external ID, or nil
+// if this external ID does not exist. It panics if the external ID is
+// bound to several records.
+func (env Environment) modelData(xmlID string) *IrModelData {
+	module, name := splitXMLID(xmlID)
+	var data []*IrModelData
+	env.Pool("IrModelData").
+		Filter("Module", "=", module).
+		Filter("Name", "=", name).
+		ReadAll(&data)
+	switch len(data) {
+	case 0:
+		return nil
+	case 1:
+		return data[0]
+	}
+	tools.LogAndPanic(log, "Duplicate external ID", "xml_id", xmlID, "count", len(data))
+	return nil
+}
+
+// recordExists returns true if the record with the given id exists in the
+// table of the given model, whether it is archived or not.
+func (env Environment) recordExists(model string, id int64) bool {
+	if id == 0 {
+		return false
+	}
+	sql, args := env.Pool(model).withIds([]int64{id}).query.countQuery()
+	var count int
+	DBGet(env.cr, &count, sql, args...)
+	return count > 0
+}
+
+// Ref returns a RecordSet on the record with the given external ID, which
+// must be of the form "module.name".
+// It panics if the external ID does not exist or if its record has been deleted.
+func (env Environment) Ref(xmlID string) *RecordSet {
+	data := env.modelData(xmlID)
+	if data == nil {
+		tools.LogAndPanic(log, "Unknown external ID", "xml_id", xmlID)
+	}
+	if !env.recordExists(data.Model, data.ResID) {
+		tools.LogAndPanic(log, "Record of external ID does not exist anymore", "xml_id", xmlID, "model", data.Model, "id", data.ResID)
+	}
+	return env.Pool(data.Model).withIds([]int64{data.ResID})
+}
+
+// HasRef returns true if a record exists with the given external ID.
+func (env Environment) HasRef(xmlID string) bool {
+	data := env.modelData(xmlID)
+	return data != nil && env.recordExists(data.Model, data.ResID)
+}
+
+// LoadRecord creates or updates the record of the given model with the
+// given external ID, so that loading the same data several times is idempotent:
+//
+// - If the external ID does not exist, the record is created from data and
+// the external ID is bound to it with the given noUpdate flag.
+// - If the external ID exists, its record is updated with data, unless the
+// external ID has been created with noUpdate.
+// - If the record of the external ID has been deleted, it is created again.
+//
+// It panics if the external ID is already bound to a record of another model.
+func (env Environment) LoadRecord(xmlID, model string, data FieldMap, noUpdate bool) *RecordSet {
+	modelName := tools.ConvertModelName(model)
+	existing := env.modelData(xmlID)
+	if existing == nil {
+		rs := env.Pool(modelName).Call("Create", data).(*RecordSet)
+		module, name := splitXMLID(xmlID)
+		env.Pool("IrModelData").Call("Create", FieldMap{
+			"Module":   module,
+			"Name":     name,
+			"Model":    modelName,
+			"ResID":    rs.ID(),
+			"NoUpdate": noUpdate,
+		})
+		return rs
+	}
+	if existing.Model != modelName {
+		tools.LogAndPanic(log, "External ID already bound to a record of another model", "xml_id", xmlID, "model", modelName, "bound_model", existing.Model)
+	}
+	if !env.recordExists(modelName, existing.ResID) {
+		rs := env.Pool(modelName).Call("Create", data).(*RecordSet)
+		env.Pool("IrModelData").withIds([]int64{existing.ID}).Call("Write", FieldMap{"ResID": rs.ID()})
+		return rs
+	}
+	rs := env.Pool(modelName).withIds([]int64{existing.ResID})
+	if !existing.NoUpdate {
+		rs.Call("Write", data)
+	}
+	return rs
+}
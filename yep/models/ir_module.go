@@ -0,0 +1,31 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+// IrModule holds the version of a module whose data has been loaded in
+// the database, so that module data is loaded only when the module is
+// installed or upgraded to a new version.
+type IrModule struct {
+	ID      int64
+	Name    string `yep:"required;unique"`
+	Version string
+}
+
+// createIrModuleModel creates the IrModule model which stores the
+// installed versions of the modules.
+func createIrModuleModel() {
+	CreateModel("IrModule")
+	ExtendModel("IrModule", new(IrModule))
+}
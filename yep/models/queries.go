@@ -24,6 +24,13 @@ import (
 
 type SQLParams []interface{}
 
+// sqlSubquery is a SQL query and its parameters that can be given as
+// argument of 'in' and 'not in' operators instead of a list of values.
+type sqlSubquery struct {
+	sql  string
+	args SQLParams
+}
+
 // Extend returns a new SQLParams with both params of this SQLParams and
 // of p2 SQLParams.
 func (p SQLParams) Extend(p2 SQLParams) SQLParams {
@@ -35,6 +42,7 @@ func (p SQLParams) Extend(p2 SQLParams) SQLParams {
 
 type Query struct {
 	recordSet *RecordSet
+	alias     string
 	cond      *Condition
 	related   []string
 	limit     int
@@ -107,10 +115,49 @@ func (q *Query) condValueSQLClause(cv condValue, first ...bool) (string, SQLPara
 		args = args.Extend(subArgs)
 	} else {
 		exprs := jsonizeExpr(q.recordSet.mi, cv.exprs)
+		isAny := cv.operator == OPERATOR_ANY || cv.operator == OPERATOR_NOT_ANY
+		if i := q.x2manyIndex(exprs); i >= 0 && (i < len(exprs)-1 || !isAny) {
+			// Conditions through x2many fields match if any related record matches
+			subExprs := exprs[i+1:]
+			if len(subExprs) == 0 {
+				subExprs = []string{"id"}
+			}
+			subCond := &Condition{params: []condValue{{exprs: subExprs, operator: cv.operator, arg: cv.arg}}}
+			subSQL, subArgs := q.existsSQLClause(exprs[:i+1], subCond)
+			sql += subSQL
+			return sql, args.Extend(subArgs)
+		}
+		if isAny {
+			if cv.operator == OPERATOR_NOT_ANY {
+				sql += "NOT "
+			}
+			subSQL, subArgs := q.existsSQLClause(exprs, conditionFromArg(cv.arg))
+			sql += subSQL
+			return sql, args.Extend(subArgs)
+		}
 		field := q.joinedFieldExpression(exprs)
-		opSql, arg := adapter.operatorSQL(cv.operator, cv.arg)
-		sql += fmt.Sprintf(`%s %s `, field, opSql)
-		args = append(args, arg)
+		fi := q.recordSet.mi.getRelatedFieldInfo(strings.Join(exprs[:len(q.generateTableJoins(exprs))], ExprSep))
+		op, arg := cv.operator, cv.arg
+		subRs, isRecordSet := recordSetArg(arg)
+		switch {
+		case op == OPERATOR_CHILD_OF || op == OPERATOR_PARENT_OF:
+			op, arg = OPERATOR_IN, q.hierarchySubquery(exprs, op, arg)
+		case op == OPERATOR_NOT_CHILD_OF:
+			op, arg = OPERATOR_NOT_IN, q.hierarchySubquery(exprs, op, arg)
+		case isRecordSet && (op == OPERATOR_IN || op == OPERATOR_NOT_IN):
+			arg = q.recordSetSubquery(exprs, subRs)
+		case op == OPERATOR_HAS_KEY:
+			field = q.jsonFieldExpression(exprs)
+		case len(q.jsonPathKeys(exprs)) > 0 && isNumericArg(arg):
+			// JSON numbers at a path are compared as numbers
+			field = adapter.jsonNumericSQL(q.jsonFieldExpression(exprs))
+		case len(q.jsonPathKeys(exprs)) > 0:
+			// Other JSON values at a path are compared as text
+			arg = jsonTextArg(arg)
+		}
+		opSQL, opArgs := adapter.operatorSQL(field, op, fi, arg)
+		sql += fmt.Sprintf(`%s `, opSQL)
+		args = args.Extend(opArgs)
 	}
 	return sql, args
 }
@@ -231,6 +278,43 @@ func (q *Query) selectQuery(fields []string) (string, SQLParams) {
 	return selQuery, args
 }
 
+// groupQuery returns the SQL query string and parameters to retrieve the
+// aggregated values of the rows pointed at by this Query object, grouped
+// by the Query's groups. aggregates maps the column name of each field to
+// aggregate to its SQL aggregate function.
+func (q *Query) groupQuery(aggregates map[string]string) (string, SQLParams) {
+	groupExprs := make([][]string, len(q.groups))
+	groupSQLs := make([]string, len(q.groups))
+	for i, group := range q.groups {
+		groupExprs[i] = jsonizeExpr(q.recordSet.mi, strings.Split(group, ExprSep))
+		groupSQLs[i] = q.joinedFieldExpression(groupExprs[i])
+	}
+	fExprs := append(groupExprs, q.cond.getAllExpressions(q.recordSet.mi)...)
+	// Fields
+	var selects []string
+	if len(groupExprs) > 0 {
+		selects = append(selects, q.fieldsSQL(groupExprs))
+	}
+	for col, op := range aggregates {
+		selects = append(selects, fmt.Sprintf("%s(%s) AS %s", op, q.joinedFieldExpression([]string{col}), col))
+	}
+	selects = append(selects, fmt.Sprintf("COUNT(*) AS %s", groupCountKey))
+	// Tables
+	tablesSQL := q.tablesSQL(fExprs)
+	// Where, group by and order by clauses
+	whereSQL, args := q.sqlWhereClause()
+	if len(groupSQLs) > 0 {
+		whereSQL += fmt.Sprintf("GROUP BY %s ", strings.Join(groupSQLs, ", "))
+		if len(q.orders) == 0 {
+			whereSQL += fmt.Sprintf("ORDER BY %s ", strings.Join(groupSQLs, ", "))
+		}
+	}
+	whereSQL += q.sqlOrderByClause()
+	whereSQL += q.sqlLimitOffsetClause()
+	selQuery := fmt.Sprintf(`SELECT %s FROM %s %s`, strings.Join(selects, ", "), tablesSQL, whereSQL)
+	return selQuery, args
+}
+
 // updateQuery returns the SQL update string and parameters to update
 // the rows pointed at by this Query object with the given FieldMap.
 func (q *Query) updateQuery(data FieldMap) (string, SQLParams) {
@@ -276,14 +360,34 @@ func (q *Query) fieldsSQL(fieldExprs [][]string) string {
 // ['profile_id' 'user_id' 'name'] => "profiles__users".name
 // ['age'] => "mytable".age
 // If withAlias is true, then returns fields with its alias
+// If exprs ends with a path inside a JSON field, the value at this path is
+// returned as text.
 func (q *Query) joinedFieldExpression(exprs []string, withAlias ...bool) string {
 	joins := q.generateTableJoins(exprs)
 	num := len(joins)
+	adapter := adapters[db.DriverName()]
+	field := fmt.Sprintf("%s.%s%s", joins[num-1].alias, exprs[num-1], adapter.jsonPathSQL(exprs[num:], true))
 	if len(withAlias) > 0 && withAlias[0] {
-		return fmt.Sprintf("%s.%s AS %s", joins[num-1].alias, exprs[num-1], strings.Join(exprs, sqlSep))
-	} else {
-		return fmt.Sprintf("%s.%s", joins[num-1].alias, exprs[num-1])
+		return fmt.Sprintf("%s AS %s", field, strings.Join(exprs, sqlSep))
 	}
+	return field
+}
+
+// jsonFieldExpression returns the sql string of the JSON value pointed at
+// by the given expressions, which must end with a JSON field, optionally
+// followed by a path of keys inside this field.
+func (q *Query) jsonFieldExpression(exprs []string) string {
+	joins := q.generateTableJoins(exprs)
+	num := len(joins)
+	adapter := adapters[db.DriverName()]
+	return fmt.Sprintf("%s.%s%s", joins[num-1].alias, exprs[num-1], adapter.jsonPathSQL(exprs[num:], false))
+}
+
+// jsonPathKeys returns the keys of the path inside a JSON field at the
+// end of the given expressions, or nil if exprs does not point inside a
+// JSON field.
+func (q *Query) jsonPathKeys(exprs []string) []string {
+	return exprs[len(q.generateTableJoins(exprs)):]
 }
 
 // generateTableJoins transforms a list of fields expression into a list of tableJoins
@@ -293,25 +397,25 @@ func (q *Query) generateTableJoins(fieldExprs []string) []tableJoin {
 	var joins []tableJoin
 
 	// Create the tableJoin for the current table
-	currentTableName := adapter.quoteTableName(q.recordSet.mi.tableName)
+	alias := q.tableAlias()
 	currentTJ := tableJoin{
-		tableName: currentTableName,
+		tableName: adapter.quoteTableName(q.recordSet.mi.tableName),
 		joined:    false,
-		alias:     currentTableName,
+		alias:     adapter.quoteTableName(alias),
 	}
 	joins = append(joins, currentTJ)
 
 	curMI := q.recordSet.mi
 	curTJ := &currentTJ
-	alias := curMI.tableName
 	exprsLen := len(fieldExprs)
 	for i, expr := range fieldExprs {
 		fi, ok := curMI.fields.get(expr)
 		if !ok {
 			tools.LogAndPanic(log, "Unparsable Expression", "expr", strings.Join(fieldExprs, ExprSep))
 		}
-		if fi.relatedModel == nil || i == exprsLen-1 {
-			// Don't create an extra join if our field is not a relation field
+		if fi.relatedModel == nil || fi.isReverse() || fi.fieldType == tools.MANY2MANY || i == exprsLen-1 {
+			// Don't create an extra join if our field is not a relation field,
+			// if it is an x2many field (they are queried in subqueries)
 			// or if it is the last field of our expressions
 			break
 		}
@@ -337,6 +441,116 @@ func (q *Query) generateTableJoins(fieldExprs []string) []tableJoin {
 	return joins
 }
 
+// tableAlias returns the alias of the main table of this Query. It is the
+// table name unless this Query is a subquery of another Query.
+func (q *Query) tableAlias() string {
+	if q.alias != "" {
+		return q.alias
+	}
+	return q.recordSet.mi.tableName
+}
+
+// x2manyIndex returns the index in exprs of the first x2many field of the
+// path, or -1 if the path does not go through an x2many field.
+func (q *Query) x2manyIndex(exprs []string) int {
+	curMI := q.recordSet.mi
+	for i, expr := range exprs {
+		fi, ok := curMI.fields.get(expr)
+		if !ok || fi.relatedModel == nil {
+			break
+		}
+		if fi.isReverse() || fi.fieldType == tools.MANY2MANY {
+			return i
+		}
+		curMI = fi.relatedModel
+	}
+	return -1
+}
+
+// existsSQLClause returns an EXISTS SQL clause and its parameters that
+// matches if any record pointed at by the relation field at the end of exprs
+// matches the given condition. The condition is given relatively to the
+// related model of the field.
+func (q *Query) existsSQLClause(exprs []string, cond *Condition) (string, SQLParams) {
+	adapter := adapters[db.DriverName()]
+	joins := q.generateTableJoins(exprs)
+	ownerAlias := joins[len(joins)-1].alias
+	fi := q.recordSet.mi.getRelatedFieldInfo(strings.Join(exprs, ExprSep))
+	if fi.relatedModel == nil {
+		tools.LogAndPanic(log, "Field is not a relation in model", "field", strings.Join(exprs, ExprSep), "model", q.recordSet.mi.name)
+	}
+	subRs := newRecordSet(q.recordSet.env, fi.relatedModel.name)
+	subQ := subRs.query
+	subQ.alias = fmt.Sprintf("%s%s%s", q.tableAlias(), sqlSep, strings.Join(exprs, sqlSep))
+	subQ.cond = cond
+	subAlias := adapter.quoteTableName(subQ.alias)
+	var link string
+	switch {
+	case fi.isReverse():
+		link = fmt.Sprintf("%s.%s = %s.id", subAlias, fi.foreignKey(), ownerAlias)
+	case fi.fieldType == tools.MANY2MANY:
+		link = fmt.Sprintf("%s.id IN (SELECT %s FROM %s WHERE %s = %s.id)", subAlias, fi.m2mTheirField,
+			adapter.quoteTableName(fi.m2mRelTable), fi.m2mOurField, ownerAlias)
+	default:
+		link = fmt.Sprintf("%s.id = %s.%s", subAlias, ownerAlias, fi.json)
+	}
+	tablesSQL := subQ.tablesSQL(append([][]string{{"id"}}, cond.getAllExpressions(fi.relatedModel)...))
+	condSQL, args := subQ.conditionSQLClause(cond)
+	if condSQL != "" {
+		link = fmt.Sprintf("%s AND (%s)", link, condSQL)
+	}
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM %s WHERE %s) ", tablesSQL, link), args
+}
+
+// recordSetSubquery returns the subquery selecting the ids of the given
+// RecordSet, used as argument of an 'in' or 'not in' condition on the field
+// given by exprs. The query of the RecordSet is inlined instead of fetching
+// its ids first.
+func (q *Query) recordSetSubquery(exprs []string, subRs *RecordSet) sqlSubquery {
+	fi := q.recordSet.mi.getRelatedFieldInfo(strings.Join(exprs, ExprSep))
+	targetMI := fi.mi
+	if fi.relatedModel != nil {
+		targetMI = fi.relatedModel
+	}
+	if (fi.json != "id" && fi.fieldType != tools.MANY2ONE && fi.fieldType != tools.ONE2ONE) || targetMI != subRs.mi {
+		tools.LogAndPanic(log, "RecordSet argument does not match the field's model", "model", q.recordSet.mi.name, "field", strings.Join(exprs, ExprSep), "argModel", subRs.mi.name)
+	}
+	subSQL, subArgs := subRs.withActiveFilter().query.selectQuery([]string{"id"})
+	return sqlSubquery{sql: subSQL, args: subArgs}
+}
+
+// recordSetArg returns the RecordSet given as condition argument and true,
+// or nil and false if arg is not a RecordSet.
+func recordSetArg(arg interface{}) (*RecordSet, bool) {
+	switch a := arg.(type) {
+	case *RecordSet:
+		return a, true
+	case RecordSet:
+		return &a, true
+	}
+	return nil, false
+}
+
+// conditionFromArg returns the Condition given as argument of an any or
+// not any operator, either as a Condition or as a Domain.
+func conditionFromArg(arg interface{}) *Condition {
+	switch a := arg.(type) {
+	case *Condition:
+		return a
+	case Condition:
+		return &a
+	case Domain:
+		if cond := ParseDomain(a); cond != nil {
+			return cond
+		}
+		return NewCondition()
+	case []interface{}:
+		return conditionFromArg(Domain(a))
+	}
+	tools.LogAndPanic(log, "Argument of 'any' operator must be a Condition or a Domain", "arg", arg)
+	return nil
+}
+
 // tablesSQL returns the SQL string for the FROM clause of our SQL query
 // including all joins if any for the given expressions.
 func (q *Query) tablesSQL(fExprs [][]string) string {
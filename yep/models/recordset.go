@@ -82,6 +82,10 @@ func (rs RecordSet) RelatedDepth(depth int) *RecordSet {
 func (rs RecordSet) create(data interface{}) *RecordSet {
 	fMap := convertInterfaceToFieldMap(data)
 	rs.mi.convertValuesToFieldType(&fMap)
+	rs.checkFieldValues(fMap)
+	rs.roundDecimalValues(fMap)
+	rs.storeAttachments(fMap)
+	rs.roundMonetaryValues(fMap)
 	// clean our fMap from ID and non stored fields
 	if idl, ok := fMap["id"]; ok && idl.(int64) == 0 {
 		delete(fMap, "id")
@@ -97,11 +101,16 @@ func (rs RecordSet) create(data interface{}) *RecordSet {
 		}
 	}
 	// insert in DB
+	rs.encodeJSONValues(fMap)
 	sql, args := rs.query.insertQuery(fMap)
 	var createdId int64
 	DBGet(rs.env.cr, &createdId, sql, args...)
 	// compute stored fields
 	rs.updateStoredFields(fMap)
+	newRs := rs.withIds([]int64{createdId})
+	if rs.mi.isHierarchical() {
+		newRs.updateParentPaths()
+	}
 	if reflect.TypeOf(data).Kind() == reflect.Ptr {
 		// set ID to the given struct
 		idVal := reflect.ValueOf(data).Elem().FieldByName("ID")
@@ -110,7 +119,7 @@ func (rs RecordSet) create(data interface{}) *RecordSet {
 		// FIXME: Add computed non stored field calculation here
 		//rs.computeFields(data)
 	}
-	return rs.withIds([]int64{createdId})
+	return newRs
 }
 
 // update updates the database with the given data and returns the number of updated rows.
@@ -120,6 +129,29 @@ func (rs RecordSet) create(data interface{}) *RecordSet {
 func (rs RecordSet) update(data interface{}) bool {
 	fMap := convertInterfaceToFieldMap(data)
 	rs.mi.convertValuesToFieldType(&fMap)
+	rs.checkFieldValues(fMap)
+	rs.roundDecimalValues(fMap)
+	rs.storeAttachments(fMap)
+	if rs.needsRecordCurrency(fMap) {
+		// Monetary values are rounded with the currency of each record
+		for _, rec := range rs.Search().Records() {
+			recMap := make(FieldMap, len(fMap))
+			for k, v := range fMap {
+				recMap[k] = v
+			}
+			rec.roundMonetaryValues(recMap)
+			rec.updateValues(recMap)
+		}
+		return true
+	}
+	rs.roundMonetaryValues(fMap)
+	rs.updateValues(fMap)
+	return true
+}
+
+// updateValues updates the database with the given FieldMap, which values
+// must have already been converted to their field type.
+func (rs RecordSet) updateValues(fMap FieldMap) {
 	// clean our fMap from ID and non stored fields
 	delete(fMap, "id")
 	delete(fMap, "ID")
@@ -130,11 +162,19 @@ func (rs RecordSet) update(data interface{}) bool {
 		}
 	}
 	// update DB
+	rs.encodeJSONValues(fMap)
+	parentChanged := rs.parentChanged(fMap)
+	if parentChanged {
+		// Get our ids before updating in case the query depends on the parent
+		rs = *rs.Search()
+	}
 	sql, args := rs.query.updateQuery(fMap)
 	DBExecute(rs.env.cr, sql, args...)
+	if parentChanged {
+		rs.updateParentPaths()
+	}
 	// compute stored fields
 	rs.updateStoredFields(fMap)
-	return true
 }
 
 // delete deletes the database record of this RecordSet and returns the number of deleted rows.
@@ -214,6 +254,8 @@ func (rs RecordSet) Distinct() *RecordSet {
 
 // Search query the database with the current filter and fills the RecordSet with the queries ids.
 // Does nothing in case RecordSet already has Ids. It panics in case of error.
+// Archived records are not returned unless the condition mentions the 'Active'
+// field or the context has 'active_test' set to false.
 // It returns a pointer to the same RecordSet.
 func (rs *RecordSet) Search() *RecordSet {
 	if len(rs.Ids()) == 0 {
@@ -240,6 +282,7 @@ SearchCount fetch from the database the number of records that match the RecordS
 It panics in case of error
 */
 func (rs RecordSet) SearchCount() int {
+	rs = *rs.withActiveFilter()
 	sql, args := rs.query.countQuery()
 	var res int
 	DBGet(rs.env.cr, &res, sql, args...)
@@ -302,6 +345,63 @@ func (rs RecordSet) ReadValue(result *FieldMap, fields ...string) {
 	*result = fieldsMap[0]
 }
 
+// ReadGroup returns the values of the given fields aggregated over the
+// records of the RecordSet grouped by the expressions given with GroupBy.
+//
+// Each returned FieldMap holds the values of the group by expressions, the
+// value of each numeric field aggregated with its group operator and the
+// number of records of the group under the "__count" key. Aggregated values
+// of float and monetary fields are returned as Decimal.
+// If no fields are given, all the numeric stored fields are aggregated.
+func (rs RecordSet) ReadGroup(fields ...string) []FieldMap {
+	if len(fields) == 0 {
+		fields = rs.mi.fields.storedFieldNames()
+	}
+	aggregates := make(map[string]string)
+	for _, field := range fields {
+		fi, ok := rs.mi.fields.get(field)
+		if !ok {
+			tools.LogAndPanic(log, "Unknown field in model", "field", field, "model", rs.mi.name)
+		}
+		if fi.json == "id" || !fi.isStored() || fi.groupOperator == "" {
+			continue
+		}
+		switch fi.fieldType {
+		case tools.INTEGER, tools.FLOAT, tools.MONETARY:
+			aggregates[fi.json] = fi.groupOperator
+		}
+	}
+	rs = *rs.withActiveFilter()
+	sql, args := rs.query.groupQuery(aggregates)
+	rows := DBQuery(rs.env.cr, sql, args...)
+	defer rows.Close()
+	var res []FieldMap
+	for rows.Next() {
+		dbValues := make(map[string]interface{})
+		if err := rows.MapScan(dbValues); err != nil {
+			tools.LogAndPanic(log, err.Error(), "model", rs.ModelName(), "fields", fields)
+		}
+		line := make(FieldMap)
+		groupValues := make(FieldMap)
+		for col, value := range dbValues {
+			switch {
+			case col == groupCountKey:
+				line[col] = value
+			case aggregates[col] != "":
+				line[col] = convertAggregate(rs.mi.fields.registryByJSON[col], value)
+			default:
+				groupValues[strings.Replace(col, sqlSep, ExprSep, -1)] = value
+			}
+		}
+		rs.mi.convertValuesToFieldType(&groupValues)
+		for k, v := range groupValues {
+			line[k] = v
+		}
+		res = append(res, line)
+	}
+	return res
+}
+
 // Values query all data of the RecordSet and map to []FieldMap.
 // fields are the fields to retrieve in the expression format,
 // i.e. "User.Profile.Age" or "user_id.profile_id.age".
@@ -312,7 +412,7 @@ func (rs RecordSet) ReadValues(results *[]FieldMap, fields ...string) int64 {
 	}
 	subFields, substs := rs.substituteRelatedFields(fields)
 	dbFields := filterOnDBFields(rs.mi, subFields)
-	sql, args := rs.query.selectQuery(dbFields)
+	sql, args := rs.withActiveFilter().query.selectQuery(dbFields)
 	rows := DBQuery(rs.env.cr, sql, args...)
 	defer rows.Close()
 	var ids []int64
@@ -323,6 +423,7 @@ func (rs RecordSet) ReadValues(results *[]FieldMap, fields ...string) int64 {
 		if err != nil {
 			tools.LogAndPanic(log, err.Error(), "model", rs.ModelName(), "fields", fields)
 		}
+		rs.loadAttachments(line)
 		*results = append(*results, line)
 		ids = append(ids, line["id"].(int64))
 	}
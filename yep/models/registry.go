@@ -61,8 +61,10 @@ func newModelCollection() *modelCollection {
 type modelInfo struct {
 	name      string
 	tableName string
+	options   Option
 	fields    *fieldsCollection
 	methods   *methodsCollection
+	uniques   [][]string
 }
 
 // addFieldsFromStruct adds the fields of the given struct to our
@@ -84,7 +86,16 @@ func (mi *modelInfo) addFieldsFromStruct(structPtr interface{}) {
 			// do not change primary key
 			continue
 		}
+		if existingFI, ok := mi.fields.get(fi.name); ok && fi.selectionAdd != nil {
+			// Extend the selection of an existing field
+			existingFI.selection = existingFI.selection.Extend(fi.selectionAdd)
+			existingFI.selectionAdd = existingFI.selectionAdd.Extend(fi.selectionAdd)
+			continue
+		}
 		mi.fields.add(fi)
+		for _, variantFI := range fi.imageVariantFieldInfos() {
+			mi.fields.add(variantFI)
+		}
 	}
 }
 
@@ -181,12 +192,21 @@ func (mi *modelInfo) convertValuesToFieldType(fMap *FieldMap) {
 		case dbValue == nil:
 			// dbValue is null, we put the type zero value instead
 			val = reflect.Zero(fType)
+		case fi.fieldType == tools.JSON:
+			var err error
+			val, err = convertJSONValue(fType, dbValue)
+			if err != nil {
+				tools.LogAndPanic(log, "Unable to convert JSON value", "model", mi.name, "field", fi.name, "value", dbValue, "error", err)
+			}
 		case reflect.PtrTo(fType).Implements(reflect.TypeOf((*sql.Scanner)(nil)).Elem()):
 			// the type implements sql.Scanner, so we call Scan
 			val = reflect.New(fType)
 			scanFunc := val.MethodByName("Scan")
 			inArgs := []reflect.Value{reflect.ValueOf(dbValue)}
-			scanFunc.Call(inArgs)
+			if errVal := scanFunc.Call(inArgs)[0]; !errVal.IsNil() {
+				tools.LogAndPanic(log, "Unable to convert value", "model", mi.name, "field", fi.name, "value", dbValue, "error", errVal.Interface())
+			}
+			val = val.Elem()
 		default:
 			if fType.Kind() == reflect.Ptr {
 				// Scan foreign keys into int64
@@ -206,6 +226,8 @@ func (mi *modelInfo) convertValuesToFieldType(fMap *FieldMap) {
 // CreateModel creates a new model with the given name
 // Available options are
 // - TRANSIENT_MODEL: each instance of the model will have a limited lifetime in database (used for wizards)
+// - HIERARCHICAL_MODEL: the 'Parent' many2one field of the model defines a tree of records
+// that can be searched with the child_of and parent_of operators.
 func CreateModel(name string, options ...Option) {
 	var opts Option
 	for _, o := range options {
@@ -217,7 +239,13 @@ func CreateModel(name string, options ...Option) {
 	} else {
 		model = new(BaseModel)
 	}
-	createModelInfo(name, model)
+	mi := createModelInfo(name, model)
+	mi.options = opts
+	if opts&HIERARCHICAL_MODEL > 0 {
+		mi.addFieldsFromStruct(new(HierarchicalModel))
+		parentPathFI, _ := mi.fields.get(parentPathField)
+		parentPathFI.readOnly = true
+	}
 	declareBaseMethods(name)
 }
 
@@ -234,7 +262,7 @@ func ExtendModel(name string, structPtrs ...interface{}) {
 
 // createModelInfo creates and populates a new modelInfo with the given name
 // by parsing the given struct pointer.
-func createModelInfo(name string, model interface{}) {
+func createModelInfo(name string, model interface{}) *modelInfo {
 	mi := &modelInfo{
 		name:      name,
 		tableName: tools.SnakeCaseString(name),
@@ -257,4 +285,5 @@ func createModelInfo(name string, model interface{}) {
 	mi.fields.add(pk)
 	mi.addFieldsFromStruct(model)
 	modelRegistry.add(mi)
+	return mi
 }
@@ -0,0 +1,75 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import "github.com/npiganeau/yep/yep/tools"
+
+const (
+	// activeField is the json name of the boolean field that marks
+	// records as active. Inactive records are said to be archived.
+	activeField = "active"
+	// activeTestKey is the context key that disables the automatic
+	// filtering of archived records when set to false.
+	activeTestKey = "active_test"
+)
+
+// hasActiveField returns true if this model has a boolean 'Active' field.
+func (mi *modelInfo) hasActiveField() bool {
+	fi, ok := mi.fields.get(activeField)
+	return ok && fi.fieldType == tools.BOOLEAN
+}
+
+// withActiveFilter returns a new RecordSet whose query only matches active
+// records if the model has an 'Active' field.
+//
+// The filter is not added if the RecordSet is defined by its ids, if the
+// context has 'active_test' set to false or if the query condition already
+// mentions the 'Active' field.
+func (rs RecordSet) withActiveFilter() *RecordSet {
+	if !rs.mi.hasActiveField() || len(rs.ids) > 0 {
+		return &rs
+	}
+	if activeTest, ok := rs.env.Context()[activeTestKey].(bool); ok && !activeTest {
+		return &rs
+	}
+	for _, exprs := range rs.query.cond.getAllExpressions(rs.mi) {
+		if len(exprs) == 1 && exprs[0] == activeField {
+			return &rs
+		}
+	}
+	return rs.Filter(activeField, "=", true)
+}
+
+// Archive sets the 'Active' field of the records of this RecordSet to false,
+// so that they are not returned by searches anymore.
+// It panics if the model has no 'Active' field.
+func (rs RecordSet) Archive() bool {
+	rs.checkActiveField()
+	return rs.Write(FieldMap{activeField: false})
+}
+
+// Unarchive sets the 'Active' field of the records of this RecordSet to true.
+// It panics if the model has no 'Active' field.
+func (rs RecordSet) Unarchive() bool {
+	rs.checkActiveField()
+	return rs.Write(FieldMap{activeField: true})
+}
+
+// checkActiveField panics if the model of this RecordSet has no 'Active' field.
+func (rs RecordSet) checkActiveField() {
+	if !rs.mi.hasActiveField() {
+		tools.LogAndPanic(log, "Model has no Active field", "model", rs.mi.name)
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/npiganeau/yep/yep/tools"
+)
+
+// BinaryInfo holds the metadata of the content of a binary field
+type BinaryInfo struct {
+	Checksum string `json:"checksum"`
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimetype"`
+}
+
+// storeAttachments saves in the filestore the content of the attachment
+// fields of fMap and replaces in place their values by the checksum of
+// their content. Content can be given either as a base64 string or as a
+// []byte.
+//
+// Image fields content is checked to be a valid image and the resized
+// variants of the image are stored and added to fMap.
+func (rs RecordSet) storeAttachments(fMap FieldMap) {
+	variants := make(FieldMap)
+	for fName, value := range fMap {
+		fi, ok := rs.mi.fields.get(fName)
+		if !ok || !fi.attachment {
+			continue
+		}
+		var data []byte
+		switch val := value.(type) {
+		case nil:
+		case []byte:
+			data = val
+		case string:
+			var err error
+			if data, err = base64.StdEncoding.DecodeString(val); err != nil {
+				tools.LogAndPanic(log, "Binary values must be base64 encoded", "model", rs.mi.name, "field", fi.name, "error", err)
+			}
+		default:
+			tools.LogAndPanic(log, "Unsupported binary value type", "model", rs.mi.name, "field", fi.name, "type", fmt.Sprintf("%T", value))
+		}
+		if fi.fieldType == tools.IMAGE && len(data) > 0 {
+			if err := tools.CheckImage(data); err != nil {
+				tools.LogAndPanic(log, err.Error(), "model", rs.mi.name, "field", fi.name)
+			}
+		}
+		fMap[fName] = rs.storeBinaryData(fi, data)
+		for _, imageSize := range fi.imageSizes {
+			var resized []byte
+			if len(data) > 0 {
+				var err error
+				if resized, err = tools.ResizeImage(data, imageSize); err != nil {
+					tools.LogAndPanic(log, "Unable to resize image", "model", rs.mi.name, "field", fi.name, "size", imageSize, "error", err)
+				}
+			}
+			variants[fi.imageVariantJSON(imageSize)] = rs.storeBinaryData(fi, resized)
+		}
+	}
+	for key, value := range variants {
+		fMap[key] = value
+	}
+}
+
+// storeBinaryData saves the given data of the given field in the filestore
+// and returns its checksum. It returns an empty string if data is empty.
+func (rs RecordSet) storeBinaryData(fi *fieldInfo, data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+	checksum, err := tools.StoreFile(bytes.NewReader(data))
+	if err != nil {
+		tools.LogAndPanic(log, "Unable to store attachment", "model", rs.mi.name, "field", fi.name, "error", err)
+	}
+	return checksum
+}
+
+// loadAttachments replaces in place the checksums of the attachment fields
+// of the given line read from the database by the base64 encoded content.
+// If the "bin_size" key of the context is true, the human readable size of
+// the content is given instead.
+func (rs RecordSet) loadAttachments(line FieldMap) {
+	binSize, _ := rs.env.context["bin_size"].(bool)
+	for key, value := range line {
+		fi, ok := rs.mi.fields.registryByJSON[key]
+		if !ok || !fi.attachment {
+			continue
+		}
+		checksum, _ := value.(string)
+		if checksum == "" {
+			continue
+		}
+		if binSize {
+			info, err := tools.StatStoredFile(checksum)
+			if err != nil {
+				log.Warn("Unable to stat attachment", "model", rs.mi.name, "field", fi.name, "checksum", checksum, "error", err)
+				line[key] = ""
+				continue
+			}
+			line[key] = tools.HumanSize(info.Size)
+			continue
+		}
+		file, err := tools.OpenStoredFile(checksum)
+		if err != nil {
+			log.Warn("Unable to open attachment", "model", rs.mi.name, "field", fi.name, "checksum", checksum, "error", err)
+			line[key] = ""
+			continue
+		}
+		data, err := ioutil.ReadAll(file)
+		file.Close()
+		if err != nil {
+			tools.LogAndPanic(log, "Unable to read attachment", "model", rs.mi.name, "field", fi.name, "checksum", checksum, "error", err)
+		}
+		line[key] = base64.StdEncoding.EncodeToString(data)
+	}
+}
+
+// attachmentField returns the fieldInfo of the given attachment field.
+// It panics if fieldName is not an attachment field of the model of rs.
+func (rs RecordSet) attachmentField(fieldName string) *fieldInfo {
+	fi, ok := rs.mi.fields.get(fieldName)
+	if !ok || !fi.attachment {
+		tools.LogAndPanic(log, "Not an attachment field", "model", rs.mi.name, "field", fieldName)
+	}
+	return fi
+}
+
+// binaryChecksum returns the checksum of the content of the given
+// attachment field for the record of rs, which must be a singleton.
+func (rs RecordSet) binaryChecksum(fi *fieldInfo) string {
+	rs.EnsureOne()
+	var checksum string
+	sql, args := rs.query.selectQuery([]string{fi.json})
+	DBGet(rs.env.cr, &checksum, sql, args...)
+	return checksum
+}
+
+// BinaryInfo returns the metadata of the content of the given attachment
+// field for the record of rs. It returns an empty BinaryInfo if the field
+// has no content. It panics if rs is not a singleton.
+func (rs RecordSet) BinaryInfo(fieldName string) BinaryInfo {
+	fi := rs.attachmentField(fieldName)
+	checksum := rs.binaryChecksum(fi)
+	if checksum == "" {
+		return BinaryInfo{}
+	}
+	info, err := tools.StatStoredFile(checksum)
+	if err != nil {
+		tools.LogAndPanic(log, "Unable to stat attachment", "model", rs.mi.name, "field", fi.name, "checksum", checksum, "error", err)
+	}
+	return BinaryInfo{
+		Checksum: checksum,
+		Size:     info.Size,
+		MimeType: info.MimeType,
+	}
+}
+
+// ReadBinary returns a reader on the content of the given attachment field
+// for the record of rs, together with the metadata of this content.
+// The returned reader is nil if the field has no content. Otherwise, it is
+// the caller's responsibility to close it.
+// It panics if rs is not a singleton.
+func (rs RecordSet) ReadBinary(fieldName string) (io.ReadCloser, BinaryInfo) {
+	info := rs.BinaryInfo(fieldName)
+	if info.Checksum == "" {
+		return nil, info
+	}
+	file, err := tools.OpenStoredFile(info.Checksum)
+	if err != nil {
+		tools.LogAndPanic(log, "Unable to open attachment", "model", rs.mi.name, "field", fieldName, "checksum", info.Checksum, "error", err)
+	}
+	return file, info
+}
+
+// WriteBinary sets the content of the given attachment field of the
+// records of rs to the data read from r. Image fields are read in memory
+// to be checked and resized, other fields are streamed to the filestore.
+func (rs RecordSet) WriteBinary(fieldName string, r io.Reader) {
+	fi := rs.attachmentField(fieldName)
+	if fi.readOnly {
+		tools.LogAndPanic(log, "Trying to write a read-only field", "model", rs.mi.name, "field", fi.name)
+	}
+	if fi.fieldType == tools.IMAGE {
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			tools.LogAndPanic(log, "Unable to read image", "model", rs.mi.name, "field", fi.name, "error", err)
+		}
+		fMap := FieldMap{fi.json: data}
+		rs.storeAttachments(fMap)
+		rs.updateValues(fMap)
+		return
+	}
+	checksum, err := tools.StoreFile(r)
+	if err != nil {
+		tools.LogAndPanic(log, "Unable to store attachment", "model", rs.mi.name, "field", fi.name, "error", err)
+	}
+	rs.updateValues(FieldMap{fi.json: checksum})
+}
+
+// CollectAttachmentsGarbage removes from the filestore all the files that
+// are not referenced by any attachment field anymore and returns the number
+// of removed files. Files more recent than minAge are kept, so that files
+// stored by transactions that are not committed yet are not removed.
+func CollectAttachmentsGarbage(minAge time.Duration) int {
+	adapter := adapters[db.DriverName()]
+	used := make(map[string]bool)
+	for _, mi := range modelRegistry.registryByName {
+		for _, fi := range mi.fields.registryByJSON {
+			if !fi.attachment {
+				continue
+			}
+			var checksums []string
+			query := fmt.Sprintf(`SELECT DISTINCT %s FROM %s`, fi.json, adapter.quoteTableName(mi.tableName))
+			if err := db.Select(&checksums, query); err != nil {
+				tools.LogAndPanic(log, "Unable to read attachment checksums", "model", mi.name, "field", fi.name, "error", err)
+			}
+			for _, checksum := range checksums {
+				used[checksum] = true
+			}
+		}
+	}
+	checksums, err := tools.ListStoredFiles(minAge)
+	if err != nil {
+		tools.LogAndPanic(log, "Unable to list filestore files", "error", err)
+	}
+	var count int
+	for _, checksum := range checksums {
+		if used[checksum] {
+			continue
+		}
+		if err := tools.DeleteStoredFile(checksum); err != nil {
+			log.Warn("Unable to remove unreferenced attachment", "checksum", checksum, "error", err)
+			continue
+		}
+		count++
+	}
+	log.Info("Attachments garbage collected", "removed", count)
+	return count
+}
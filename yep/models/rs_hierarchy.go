@@ -0,0 +1,178 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/npiganeau/yep/yep/tools"
+)
+
+const (
+	// parentField is the json name of the many2one field that links
+	// a record of a hierarchical model to its parent.
+	parentField = "parent_id"
+	// parentPathField is the json name of the materialized path of
+	// the records of a hierarchical model.
+	parentPathField = "parent_path"
+	// parentPathSep separates the ids in a parent path
+	parentPathSep = "/"
+)
+
+// isHierarchical returns true if this model has been created with
+// the HIERARCHICAL_MODEL option.
+func (mi *modelInfo) isHierarchical() bool {
+	return mi.options&HIERARCHICAL_MODEL > 0
+}
+
+// parentChanged returns true if the given FieldMap sets the parent of
+// the records of a hierarchical model.
+func (rs RecordSet) parentChanged(fMap FieldMap) bool {
+	if !rs.mi.isHierarchical() {
+		return false
+	}
+	parentFI, _ := rs.mi.fields.get(parentField)
+	_, jsonOK := fMap[parentFI.json]
+	_, nameOK := fMap[parentFI.name]
+	return jsonOK || nameOK
+}
+
+// updateParentPaths recomputes the parent path of the records of this
+// RecordSet and of all their descendants from the current value of their
+// parent field in the database. rs must have been searched.
+// It panics if the parent of one of the records is one of its descendants.
+func (rs RecordSet) updateParentPaths() {
+	adapter := adapters[db.DriverName()]
+	table := adapter.quoteTableName(rs.mi.tableName)
+	for _, id := range rs.ids {
+		var oldPath string
+		DBGet(rs.env.cr, &oldPath, fmt.Sprintf(`SELECT %s FROM %s WHERE id = ?`, parentPathField, table), id)
+		var parentPath string
+		DBGet(rs.env.cr, &parentPath, fmt.Sprintf(`
+			SELECT COALESCE((SELECT p.%[1]s FROM %[2]s p WHERE p.id = c.%[3]s), '')
+			FROM %[2]s c WHERE c.id = ?`, parentPathField, table, parentField), id)
+		if oldPath != "" && strings.HasPrefix(parentPath, oldPath) {
+			tools.LogAndPanic(log, "Recursion detected in hierarchy", "model", rs.mi.name, "id", id)
+		}
+		newPath := fmt.Sprintf("%s%d%s", parentPath, id, parentPathSep)
+		if oldPath == "" {
+			// New record, it has no descendants yet
+			DBExecute(rs.env.cr, fmt.Sprintf(`UPDATE %s SET %s = ? WHERE id = ?`, table, parentPathField), newPath, id)
+			continue
+		}
+		DBExecute(rs.env.cr, fmt.Sprintf(`
+			UPDATE %[1]s SET %[2]s = ? || SUBSTR(%[2]s, ?)
+			WHERE %[2]s LIKE ?`, table, parentPathField), newPath, len(oldPath)+1, oldPath+"%")
+	}
+}
+
+// hierarchySubquery returns the subquery selecting the ids matched by a
+// child_of, not child_of or parent_of condition on the field given by exprs.
+// This field must be either the id of a hierarchical model or a many2one
+// field to such a model.
+//
+// The parent paths of the records given by arg are fetched first, so that
+// the condition compiles to prefix queries on the indexed parent_path column.
+// For not child_of, the subquery selects the ids that must be excluded.
+func (q *Query) hierarchySubquery(exprs []string, op DomainOperator, arg interface{}) sqlSubquery {
+	adapter := adapters[db.DriverName()]
+	fi := q.recordSet.mi.getRelatedFieldInfo(strings.Join(exprs, ExprSep))
+	hierMI := fi.mi
+	if fi.fieldType == tools.MANY2ONE {
+		hierMI = fi.relatedModel
+	}
+	if (fi.json != "id" && fi.fieldType != tools.MANY2ONE) || !hierMI.isHierarchical() {
+		tools.LogAndPanic(log, "Hierarchy operators can only be used on hierarchical models", "model", q.recordSet.mi.name, "field", strings.Join(exprs, ExprSep), "operator", op)
+	}
+	table := adapter.quoteTableName(hierMI.tableName)
+	ids := idsFromArg(arg)
+	var paths []string
+	if len(ids) > 0 {
+		query := fmt.Sprintf(`SELECT %s FROM %s WHERE id IN (?)`, parentPathField, table)
+		query, args, err := sqlx.In(query, ids)
+		if err != nil {
+			tools.LogAndPanic(log, "Unable to expand 'IN' statement", "error", err, "sql", query, "args", args)
+		}
+		DBSelect(q.recordSet.env.cr, &paths, query, args...)
+	}
+	var (
+		conds []string
+		args  SQLParams
+	)
+	switch op {
+	case OPERATOR_CHILD_OF, OPERATOR_NOT_CHILD_OF:
+		for _, path := range paths {
+			conds = append(conds, fmt.Sprintf("%s LIKE ?", parentPathField))
+			args = append(args, path+"%")
+		}
+	case OPERATOR_PARENT_OF:
+		var parentIds []int64
+		for _, path := range paths {
+			parentIds = append(parentIds, parentPathIds(path)...)
+		}
+		if len(parentIds) > 0 {
+			conds = append(conds, "id IN (?)")
+			args = append(args, parentIds)
+		}
+	}
+	if len(conds) == 0 {
+		conds = []string{"FALSE"}
+	}
+	return sqlSubquery{
+		sql:  fmt.Sprintf("SELECT id FROM %s WHERE %s", table, strings.Join(conds, " OR ")),
+		args: args,
+	}
+}
+
+// parentPathIds returns the ids of the given parent path
+func parentPathIds(path string) []int64 {
+	var res []int64
+	for _, idStr := range strings.Split(strings.Trim(path, parentPathSep), parentPathSep) {
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			continue
+		}
+		res = append(res, id)
+	}
+	return res
+}
+
+// idsFromArg returns the ids given by arg, which can be an id,
+// a slice of ids or a RecordSet.
+func idsFromArg(arg interface{}) []int64 {
+	switch a := arg.(type) {
+	case int:
+		return []int64{int64(a)}
+	case int64:
+		return []int64{a}
+	case []int64:
+		return a
+	case []int:
+		res := make([]int64, len(a))
+		for i, id := range a {
+			res[i] = int64(id)
+		}
+		return res
+	case RecordSet:
+		return a.Search().Ids()
+	case *RecordSet:
+		return a.Search().Ids()
+	}
+	tools.LogAndPanic(log, "Unable to get ids from argument", "arg", arg)
+	return nil
+}
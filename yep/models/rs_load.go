@@ -0,0 +1,198 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/npiganeau/yep/yep/tools"
+)
+
+// Suffixes of the column names of the 'Load' method giving relational
+// values by external ID or by database id instead of by name.
+var (
+	loadXMLIDSuffixes = []string{"/id", ":id"}
+	loadDBIDSuffix    = "/.id"
+)
+
+// A loadColumn is a column of the data given to the 'Load' method.
+type loadColumn struct {
+	fi    *fieldInfo
+	xmlID bool
+	dbID  bool
+}
+
+// loadColumns returns the loadColumns of the given column names.
+// The 'id' column of external IDs has a nil fieldInfo.
+func (rs RecordSet) loadColumns(fields []string) []loadColumn {
+	columns := make([]loadColumn, len(fields))
+	for i, field := range fields {
+		if field == "id" {
+			continue
+		}
+		var col loadColumn
+		for _, suffix := range loadXMLIDSuffixes {
+			if strings.HasSuffix(field, suffix) {
+				field = strings.TrimSuffix(field, suffix)
+				col.xmlID = true
+			}
+		}
+		if strings.HasSuffix(field, loadDBIDSuffix) {
+			field = strings.TrimSuffix(field, loadDBIDSuffix)
+			col.dbID = true
+		}
+		fi, ok := rs.mi.fields.get(field)
+		if !ok {
+			tools.LogAndPanic(log, "Unknown field in model", "field", field, "model", rs.mi.name)
+		}
+		if (col.xmlID || col.dbID) && fi.relatedModel == nil {
+			tools.LogAndPanic(log, "Only relational fields can be given by id", "field", field, "model", rs.mi.name)
+		}
+		col.fi = fi
+		columns[i] = col
+	}
+	return columns
+}
+
+// loadRow creates or updates the record of the given row of string values,
+// which are given in the order of columns, and returns it.
+//
+// The record is created or updated by its external ID if there is an 'id'
+// column. External IDs without module are prefixed with the given module.
+// Reverse and many2many fields link the given records to the loaded record.
+func (rs RecordSet) loadRow(columns []loadColumn, row []string, module string, noUpdate bool) *RecordSet {
+	if len(row) != len(columns) {
+		tools.LogAndPanic(log, "Wrong number of values", "model", rs.mi.name, "values", row, "expected", len(columns))
+	}
+	values := make(FieldMap)
+	reverseValues := make(map[*fieldInfo][]int64)
+	var xmlID string
+	for i, col := range columns {
+		if col.fi == nil {
+			xmlID = strings.TrimSpace(row[i])
+			continue
+		}
+		value := rs.loadValue(col, row[i], module)
+		if col.fi.isReverse() || col.fi.fieldType == tools.MANY2MANY {
+			if value != nil {
+				reverseValues[col.fi] = value.([]int64)
+			}
+			continue
+		}
+		values[col.fi.name] = value
+	}
+	var rec *RecordSet
+	if xmlID == "" {
+		rec = rs.Call("Create", values).(*RecordSet)
+	} else {
+		rec = rs.env.LoadRecord(fullXMLID(module, xmlID), rs.mi.name, values, noUpdate)
+	}
+	for fi, ids := range reverseValues {
+		if fi.fieldType == tools.MANY2MANY {
+			rec.setM2MLinks(fi, ids)
+			continue
+		}
+		rs.env.Pool(fi.relatedModel.name).withIds(ids).Call("Write", FieldMap{fi.foreignKey(): rec.ID()})
+	}
+	return rec
+}
+
+// setM2MLinks replaces the records linked to this record through the given
+// many2many field by the records of the related model with the given ids.
+func (rs RecordSet) setM2MLinks(fi *fieldInfo, ids []int64) {
+	adapter := adapters[db.DriverName()]
+	relTable := adapter.quoteTableName(fi.m2mRelTable)
+	DBExecute(rs.env.cr, fmt.Sprintf(`DELETE FROM %s WHERE %s = ?`, relTable, fi.m2mOurField), rs.ID())
+	linked := make(map[int64]bool)
+	for _, id := range ids {
+		if linked[id] {
+			continue
+		}
+		linked[id] = true
+		DBExecute(rs.env.cr, fmt.Sprintf(`INSERT INTO %s (%s, %s) VALUES (?, ?)`, relTable, fi.m2mOurField, fi.m2mTheirField), rs.ID(), id)
+	}
+}
+
+// loadValue returns the value of the field of col from the given string.
+// Empty strings give nil. Relational values are given by name, by external
+// ID or by database id according to col, and as comma separated lists for
+// reverse and many2many fields, which are returned as []int64.
+func (rs RecordSet) loadValue(col loadColumn, value, module string) interface{} {
+	fi := col.fi
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+	var (
+		res interface{}
+		err error
+	)
+	switch {
+	case fi.relatedModel != nil:
+		multi := fi.isReverse() || fi.fieldType == tools.MANY2MANY
+		tokens := []string{value}
+		if multi {
+			tokens = strings.Split(value, ",")
+		}
+		ids := make([]int64, len(tokens))
+		for i, token := range tokens {
+			ids[i] = rs.loadRelatedID(col, strings.TrimSpace(token), module)
+		}
+		if multi {
+			return ids
+		}
+		return ids[0]
+	case fi.fieldType == tools.INTEGER:
+		res, err = strconv.ParseInt(value, 10, 64)
+	case fi.fieldType == tools.FLOAT || fi.fieldType == tools.MONETARY:
+		res, err = strconv.ParseFloat(value, 64)
+	case fi.fieldType == tools.BOOLEAN:
+		res, err = strconv.ParseBool(value)
+	default:
+		res = value
+	}
+	if err != nil {
+		tools.LogAndPanic(log, "Invalid field value", "model", rs.mi.name, "field", fi.name, "value", value, "error", err)
+	}
+	return res
+}
+
+// loadRelatedID returns the id of the record of the related model of the
+// field of col given by value, which is either an external ID, a database
+// id or the name of the record according to col.
+func (rs RecordSet) loadRelatedID(col loadColumn, value, module string) int64 {
+	relModel := col.fi.relatedModel.name
+	switch {
+	case col.xmlID:
+		relRS := rs.env.Ref(fullXMLID(module, value))
+		if relRS.ModelName() != relModel {
+			tools.LogAndPanic(log, "External ID is not a record of the related model", "field", col.fi.name, "xml_id", value, "model", relRS.ModelName(), "expected", relModel)
+		}
+		return relRS.ID()
+	case col.dbID:
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			tools.LogAndPanic(log, "Invalid database id", "field", col.fi.name, "value", value, "error", err)
+		}
+		return id
+	}
+	refs := rs.env.Pool(relModel).Call("NameSearch", NameSearchParams{Name: value, Operator: "=", Limit: 2}).([]RecordRef)
+	if len(refs) != 1 {
+		tools.LogAndPanic(log, "Name does not match exactly one record", "field", col.fi.name, "model", relModel, "name", value, "found", len(refs))
+	}
+	return refs[0].ID
+}
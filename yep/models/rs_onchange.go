@@ -0,0 +1,121 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"fmt"
+	"reflect"
+	"sync/atomic"
+)
+
+// onchangeSavepointSeq numbers the database savepoints inside which
+// pseudo-records are created, so that nested pseudo-records each roll
+// back to their own savepoint.
+var onchangeSavepointSeq uint64
+
+// withPseudoRecord calls fnct with a singleton RecordSet holding the given
+// values. If values has a non zero "id", the pseudo-record is the existing
+// record updated with the given values, otherwise it is a new record.
+//
+// The pseudo-record lives in a savepoint of the current transaction so that
+// methods and computed fields can be evaluated on it as on any other record.
+// The savepoint is rolled back and released when fnct returns or panics,
+// including when the pseudo-record itself cannot be written.
+func (rs RecordSet) withPseudoRecord(values FieldMap, fnct func(rec *RecordSet)) {
+	savepoint := fmt.Sprintf("yep_onchange_%d", atomic.AddUint64(&onchangeSavepointSeq, 1))
+	DBExecute(rs.env.cr, "SAVEPOINT "+savepoint)
+	defer func() {
+		DBExecute(rs.env.cr, "ROLLBACK TO SAVEPOINT "+savepoint)
+		DBExecute(rs.env.cr, "RELEASE SAVEPOINT "+savepoint)
+	}()
+	fnct(rs.newPseudoRecord(values))
+}
+
+// newPseudoRecord writes the given values in the database and returns the
+// pseudo-record. It must only be called by withPseudoRecord.
+func (rs RecordSet) newPseudoRecord(values FieldMap) *RecordSet {
+	var id int64
+	switch idVal := values["id"].(type) {
+	case float64:
+		id = int64(idVal)
+	case int64:
+		id = idVal
+	}
+	fMap := rs.pseudoRecordValues(values, id == 0)
+	if id != 0 {
+		rec := rs.env.Pool(rs.ModelName()).withIds([]int64{id})
+		rec.writePseudoRecordValues(fMap)
+		return rec
+	}
+	rs.encodeJSONValues(fMap)
+	sql, args := rs.query.insertQuery(fMap)
+	var createdId int64
+	DBGet(rs.env.cr, &createdId, sql, args...)
+	rs.updateStoredFields(fMap)
+	return rs.env.Pool(rs.ModelName()).withIds([]int64{createdId})
+}
+
+// writePseudoRecordValues writes the given values prepared by
+// pseudoRecordValues on this pseudo-record.
+func (rs RecordSet) writePseudoRecordValues(fMap FieldMap) {
+	if len(fMap) > 0 {
+		rs.updateValues(fMap)
+	}
+}
+
+// pseudoRecordValues returns the values of a form being edited converted
+// to be written directly in the database, without the checks and the
+// attachments storage of create and update:
+// - attachment, read-only and non stored fields are ignored so that nothing
+// is written in the filestore,
+// - empty values of NOT NULL columns are replaced by the zero value of the field,
+// - if isNew is true, missing required non relational fields are set to their
+// zero value.
+func (rs RecordSet) pseudoRecordValues(values FieldMap, isNew bool) FieldMap {
+	fMap := make(FieldMap)
+	for k, v := range values {
+		fi, ok := rs.mi.fields.get(k)
+		if !ok || fi.json == "id" || !fi.isStored() || fi.readOnly || fi.attachment {
+			continue
+		}
+		if ref, ok := v.([]interface{}); ok && fi.relatedModel != nil && len(ref) > 0 {
+			// The client sends relations as [id, name] pairs
+			v = ref[0]
+		}
+		fMap[fi.json] = v
+	}
+	if isNew {
+		for jName, fi := range rs.mi.fields.registryByJSON {
+			if _, exists := fMap[jName]; !exists && fi.required && fi.relatedModel == nil && fi.isStored() && !fi.attachment {
+				fMap[jName] = nil
+			}
+		}
+	}
+	rs.mi.convertValuesToFieldType(&fMap)
+	adapter := adapters[db.DriverName()]
+	for k, v := range fMap {
+		fi := rs.mi.getRelatedFieldInfo(k)
+		if v == nil && fi.relatedModel == nil && adapter.fieldIsNotNull(fi) {
+			fMap[k] = reflect.Zero(fi.structField.Type).Interface()
+		}
+	}
+	return fMap
+}
+
+// triggersOnchange returns true if a change of the value of this field
+// in a form view must be reported to the server.
+func (fi *fieldInfo) triggersOnchange() bool {
+	return fi.onchange != "" || len(fi.dependencies) > 0
+}
@@ -0,0 +1,329 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/npiganeau/yep/yep/tools"
+)
+
+const (
+	// currencyScaleField is the name of the field of currency models that
+	// holds the number of decimal places of the currency.
+	currencyScaleField = "DecimalPlaces"
+	// defaultMonetaryScale is the number of decimal places of monetary
+	// values that have no currency.
+	defaultMonetaryScale int32 = 2
+	// monetaryPrecision is the total number of digits of monetary values
+	// reported to the client.
+	monetaryPrecision = 16
+)
+
+// checkFieldValues panics if one of the values of the given FieldMap is
+// not allowed for its field. fMap keys must be field JSON names.
+func (rs RecordSet) checkFieldValues(fMap FieldMap) {
+	for fName, value := range fMap {
+		fi, ok := rs.mi.fields.get(fName)
+		if !ok {
+			continue
+		}
+		if fi.readOnly {
+			tools.LogAndPanic(log, "Trying to write a read-only field", "model", rs.mi.name, "field", fi.name)
+		}
+		switch fi.fieldType {
+		case tools.SELECTION:
+			rs.checkSelectionValue(fi, value)
+		case tools.REFERENCE:
+			rs.checkReferenceValue(fi, value)
+		}
+	}
+}
+
+// checkSelectionValue panics if value is not one of the keys of the
+// selection of the given field. Empty values are always allowed.
+func (rs RecordSet) checkSelectionValue(fi *fieldInfo, value interface{}) {
+	if value == nil {
+		return
+	}
+	key := fmt.Sprintf("%v", value)
+	if key == "" {
+		return
+	}
+	if _, ok := rs.selectionOf(fi).Label(key); !ok {
+		tools.LogAndPanic(log, "Invalid value for selection field", "model", rs.mi.name, "field", fi.name, "value", key)
+	}
+}
+
+// checkReferenceValue panics if value is a Reference to a model that is not
+// allowed for the given field. Null references are always allowed.
+func (rs RecordSet) checkReferenceValue(fi *fieldInfo, value interface{}) {
+	ref, ok := value.(Reference)
+	if !ok || ref.IsNull() {
+		return
+	}
+	if _, ok := modelRegistry.get(ref.ModelName()); !ok {
+		tools.LogAndPanic(log, "Unknown model in reference", "model", rs.mi.name, "field", fi.name, "value", ref)
+	}
+	if len(fi.refModels) == 0 {
+		return
+	}
+	for _, refModel := range fi.refModels {
+		if refModel == ref.ModelName() {
+			return
+		}
+	}
+	tools.LogAndPanic(log, "Model not allowed in reference field", "model", rs.mi.name, "field", fi.name, "value", ref, "allowed", fi.refModels)
+}
+
+// referenceModelsOf returns the names of the models that the given reference
+// field can point to, as a Selection. If the field does not restrict its
+// target models, all the models of the registry are returned.
+func referenceModelsOf(fi *fieldInfo) Selection {
+	refModels := fi.refModels
+	if len(refModels) == 0 {
+		for modelName := range modelRegistry.registryByName {
+			refModels = append(refModels, modelName)
+		}
+		sort.Strings(refModels)
+	}
+	res := make(Selection, len(refModels))
+	for i, refModel := range refModels {
+		res[i] = [2]string{refModel, refModel}
+	}
+	return res
+}
+
+// selectionOf returns the Selection of the given field, either declared
+// statically or returned by the field's selection method extended with the
+// options added by selection_add. For reference fields, the allowed target
+// models are returned.
+func (rs RecordSet) selectionOf(fi *fieldInfo) Selection {
+	if fi.fieldType == tools.REFERENCE {
+		return referenceModelsOf(fi)
+	}
+	if fi.selectionFunc != "" {
+		selection, ok := rs.Call(fi.selectionFunc).(Selection)
+		if !ok {
+			tools.LogAndPanic(log, "Selection method must return a Selection", "model", rs.mi.name, "field", fi.name, "method", fi.selectionFunc)
+		}
+		return selection.Extend(fi.selectionAdd)
+	}
+	return fi.selection
+}
+
+// translatedSelectionOf returns the Selection of the given field with its
+// labels translated in the language of the context.
+func (rs RecordSet) translatedSelectionOf(fi *fieldInfo) Selection {
+	selection := rs.selectionOf(fi)
+	lang, _ := rs.env.context["lang"].(string)
+	if lang == "" || selection == nil {
+		return selection
+	}
+	res := make(Selection, len(selection))
+	for i, item := range selection {
+		res[i] = [2]string{item[0], tools.TranslateString(lang, item[1])}
+	}
+	return res
+}
+
+// roundDecimalValues rounds in place the values of fMap whose fields have
+// digits to the scale of these digits.
+//
+// Fields with digits are stored in numeric columns whatever their Go type,
+// but only Decimal fields hold exact values. float64 values are rounded
+// through a Decimal so that the stored value is the decimal one the user
+// sees, but they are read back as the nearest float64.
+func (rs RecordSet) roundDecimalValues(fMap FieldMap) {
+	for fName, value := range fMap {
+		fi, ok := rs.mi.fields.get(fName)
+		if !ok || fi.fieldType != tools.FLOAT || fi.digits == (tools.Digits{}) {
+			continue
+		}
+		switch val := value.(type) {
+		case Decimal:
+			fMap[fName] = val.Round(int32(fi.digits[1]))
+		case float64:
+			fMap[fName] = NewDecimalFromFloat(val).Round(int32(fi.digits[1])).Float64()
+		}
+	}
+}
+
+// encodeJSONValues replaces in place the values of the JSON fields of fMap
+// by their JSON document, ready to be stored in database.
+// Zero values are stored as NULL.
+func (rs RecordSet) encodeJSONValues(fMap FieldMap) {
+	for fName, value := range fMap {
+		fi, ok := rs.mi.fields.get(fName)
+		if !ok || fi.fieldType != tools.JSON {
+			continue
+		}
+		if value == nil || reflect.DeepEqual(value, reflect.Zero(fi.structField.Type).Interface()) {
+			fMap[fName] = nil
+			continue
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			tools.LogAndPanic(log, "Unable to marshal JSON value", "model", rs.mi.name, "field", fi.name, "value", value, "error", err)
+		}
+		fMap[fName] = string(data)
+	}
+}
+
+// convertAggregate converts the given aggregated database value of the
+// given field to Decimal for float and monetary fields. Aggregates of
+// integer fields are returned as int64, or as Decimal if the aggregate
+// function returns a fractional number, like avg.
+func convertAggregate(fi *fieldInfo, value interface{}) interface{} {
+	switch fi.fieldType {
+	case tools.FLOAT, tools.MONETARY:
+		var dec Decimal
+		if err := dec.Scan(value); err != nil {
+			tools.LogAndPanic(log, "Unable to convert aggregated value", "model", fi.mi.name, "field", fi.name, "value", value, "error", err)
+		}
+		return dec
+	}
+	switch val := value.(type) {
+	case []byte:
+		// Some aggregates of integers, such as avg, return numeric values
+		dec, err := ParseDecimal(string(val))
+		if err != nil {
+			tools.LogAndPanic(log, "Unable to convert aggregated value", "model", fi.mi.name, "field", fi.name, "value", value, "error", err)
+		}
+		return dec
+	case nil:
+		return int64(0)
+	}
+	return value
+}
+
+// needsRecordCurrency returns true if fMap holds a monetary value whose
+// currency is not set in fMap, in which case the currency of each record
+// must be used for rounding.
+func (rs RecordSet) needsRecordCurrency(fMap FieldMap) bool {
+	for fName := range fMap {
+		fi, ok := rs.mi.fields.get(fName)
+		if !ok || fi.fieldType != tools.MONETARY {
+			continue
+		}
+		currencyFI, _ := rs.mi.fields.get(fi.currencyField)
+		_, jsonOK := fMap[currencyFI.json]
+		_, nameOK := fMap[currencyFI.name]
+		if !jsonOK && !nameOK {
+			return true
+		}
+	}
+	return false
+}
+
+// roundMonetaryValues rounds in place the monetary values of fMap with
+// the number of decimal places of their currency. The currency is taken
+// from fMap if it is set, or else from the record of rs if it is a singleton.
+func (rs RecordSet) roundMonetaryValues(fMap FieldMap) {
+	for fName, value := range fMap {
+		fi, ok := rs.mi.fields.get(fName)
+		if !ok || fi.fieldType != tools.MONETARY {
+			continue
+		}
+		if dec, ok := value.(Decimal); ok {
+			fMap[fName] = dec.Round(rs.currencyScale(fi, fMap))
+		}
+	}
+}
+
+// currencyScale returns the number of decimal places of the currency of
+// the given monetary field. The currency is taken from fMap if it is set,
+// or else from the record of rs if it is a singleton.
+func (rs RecordSet) currencyScale(fi *fieldInfo, fMap FieldMap) int32 {
+	currencyFI, _ := rs.mi.fields.get(fi.currencyField)
+	currencyVal, ok := fMap[currencyFI.json]
+	if !ok {
+		currencyVal, ok = fMap[currencyFI.name]
+	}
+	if !ok && len(rs.ids) == 1 {
+		var recMap FieldMap
+		rs.ReadValue(&recMap, currencyFI.json)
+		currencyVal = recMap[currencyFI.json]
+	}
+	currencyID, _ := currencyVal.(int64)
+	return rs.env.currencyScaleByID(currencyFI.relatedModel, currencyID)
+}
+
+// currencyScaleByID returns the number of decimal places of the currency
+// with the given id in the given currency model. It returns the default
+// monetary scale if currencyID is 0, if the currency does not exist or if
+// its number of decimal places is not set.
+func (env Environment) currencyScaleByID(currencyMI *modelInfo, currencyID int64) int32 {
+	if currencyID == 0 {
+		return defaultMonetaryScale
+	}
+	scaleFI, _ := currencyMI.fields.get(currencyScaleField)
+	var currMaps []FieldMap
+	env.Pool(currencyMI.name).withIds([]int64{currencyID}).ReadValues(&currMaps, scaleFI.json)
+	if len(currMaps) == 0 {
+		return defaultMonetaryScale
+	}
+	scale := reflect.ValueOf(currMaps[0][scaleFI.json])
+	switch scale.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int32(scale.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int32(scale.Uint())
+	}
+	return defaultMonetaryScale
+}
+
+// contextMonetaryDigits returns the digits to report to the client for the
+// given monetary field, using the currency given by the "currency_id" key
+// of the context, if any.
+func (rs RecordSet) contextMonetaryDigits(fi *fieldInfo) *tools.Digits {
+	var currencyID int64
+	switch val := rs.env.context["currency_id"].(type) {
+	case int64:
+		currencyID = val
+	case float64:
+		currencyID = int64(val)
+	}
+	currencyFI, _ := rs.mi.fields.get(fi.currencyField)
+	scale := rs.env.currencyScaleByID(currencyFI.relatedModel, currencyID)
+	return &tools.Digits{monetaryPrecision, int(scale)}
+}
+
+// MonetaryScale returns the number of decimal places of the currency of
+// the given monetary field for the record of rs.
+// It panics if rs is not a singleton or if fieldName is not a monetary field.
+func (rs RecordSet) MonetaryScale(fieldName string) int32 {
+	rs.EnsureOne()
+	fi, ok := rs.mi.fields.get(fieldName)
+	if !ok || fi.fieldType != tools.MONETARY {
+		tools.LogAndPanic(log, "Not a monetary field", "model", rs.mi.name, "field", fieldName)
+	}
+	return rs.Search().currencyScale(fi, FieldMap{})
+}
+
+// FormatMonetary returns the value of the given monetary field for the
+// record of rs formatted with the number of decimal places of its currency.
+// It panics if rs is not a singleton or if fieldName is not a monetary field.
+func (rs RecordSet) FormatMonetary(fieldName string) string {
+	scale := rs.MonetaryScale(fieldName)
+	fi, _ := rs.mi.fields.get(fieldName)
+	var fMap FieldMap
+	rs.Search().ReadValue(&fMap, fi.json)
+	value, _ := fMap[fi.json].(Decimal)
+	return value.StringFixed(scale)
+}
@@ -93,6 +93,10 @@ func TestCreateDB(t *testing.T) {
 		ExtendModel("Post", new(Post))
 		CreateModel("Tag")
 		ExtendModel("Tag", new(Tag), new(Tag_Extension))
+		CreateModel("Currency")
+		ExtendModel("Currency", new(Currency))
+		CreateModel("Category", HIERARCHICAL_MODEL)
+		ExtendModel("Category", new(Category))
 
 		DeclareMethod("User", "PrefixedUser", PrefixUser)
 		DeclareMethod("User", "PrefixedUser", PrefixUserEmailExtension)
@@ -100,6 +104,9 @@ func TestCreateDB(t *testing.T) {
 		DeclareMethod("User", "DecorateEmail", DecorateEmailExtension)
 		DeclareMethod("User", "computeDecoratedName", computeDecoratedName)
 		DeclareMethod("User", "computeAge", computeAge)
+		DeclareMethod("User", "onchangeIsStaff", onchangeIsStaff)
+		DeclareMethod("User", "onchangeNums", onchangeNums)
+		DeclareMethod("Tag", "tagColors", tagColors)
 
 		// Creating a dummy table to check that it is correctly removed by Bootstrap
 		db.MustExec("CREATE TABLE IF NOT EXISTS shouldbedeleted (id serial NOT NULL PRIMARY KEY)")
@@ -118,8 +125,18 @@ func TestCreateDB(t *testing.T) {
 				So(dbTables[tableName], ShouldBeTrue)
 			}
 		})
-		Convey("All DB tables should have a model", func() {
+		Convey("All many2many fields should have a link table", func() {
+			dbTables := testAdapter.tables()
+			for relTable := range m2mRelTables() {
+				So(dbTables[relTable], ShouldBeTrue)
+			}
+		})
+		Convey("All DB tables should have a model or be a link table", func() {
+			relTables := m2mRelTables()
 			for dbTable := range testAdapter.tables() {
+				if _, ok := relTables[dbTable]; ok {
+					continue
+				}
 				So(modelRegistry.registryByTableName, ShouldContainKey, dbTable)
 			}
 		})
@@ -138,12 +155,12 @@ type User struct {
 	Email         string `yep:"size(100);help(The user's email address);index"`
 	Password      string
 	Status        int16 `yep:"json(status_json)"`
-	IsStaff       bool
+	IsStaff       bool  `yep:"onchange(onchangeIsStaff)"`
 	IsActive      bool
 	Profile       *Profile `yep:"type(many2one)"` //;on_delete(set_null)"`
 	Age           int16    `yep:"compute(computeAge);store;depends(Profile.Age,Profile)"`
 	Posts         []*Post  `yep:"type(one2many)"`
-	Nums          int
+	Nums          int      `yep:"onchange(onchangeNums)"`
 	unexportBool  bool
 	PMoney        float64 `yep:"related(Profile.Money)"`
 	LastPost      *Post   `yep:"inherits"`
@@ -175,7 +192,13 @@ type Profile struct {
 	Age      int16
 	Money    float64
 	User     *User
-	BestPost *Post `yep:"type(one2one)"`
+	BestPost *Post  `yep:"type(one2one)"`
+	Gender   string `yep:"selection(male|Male,female|Female)"`
+	Currency *Currency
+	Balance  Decimal `yep:"currency_field(Currency)"`
+	Resume   string  `yep:"attachment"`
+	Avatar   string  `yep:"type(image);sizes(64,16)"`
+	Birthday Date
 }
 
 type Profile_PartialWithBestPost struct {
@@ -186,12 +209,23 @@ type Profile_PartialWithBestPost struct {
 }
 
 type Post struct {
-	User    *User
-	Title   string
-	Content string `yep:"type(text)"`
+	User     *User
+	Title    string
+	Content  string    `yep:"type(text)"`
+	Origin   Reference `yep:"models(User,Tag)"`
+	Rating   Decimal   `yep:"digits(5,2)"`
+	Score    float64   `yep:"digits(4,1)"`
+	Meta     map[string]interface{}
+	Layout   PostLayout `yep:"type(json)"`
+	Keywords []string   `yep:"type(json)"`
 	//Tags    []*Tag `yep:"type(many2many)"`
 }
 
+type PostLayout struct {
+	Theme   string `json:"theme"`
+	Columns int    `json:"columns"`
+}
+
 func (u *Post) TableIndex() [][]string {
 	return [][]string{
 		{"Id", "Title"},
@@ -202,6 +236,18 @@ type Tag struct {
 	Name     string
 	BestPost *Post
 	Posts    []*Post `yep:"type(many2many)"`
+	Color    string  `yep:"selection_func(tagColors)"`
+}
+
+type Currency struct {
+	Name          string
+	DecimalPlaces int16
+}
+
+type Category struct {
+	Name   string
+	Parent *Category
+	Kind   string `yep:"selection_add(main|Main,sub|Sub)"`
 }
 
 type User_Extension struct {
@@ -212,8 +258,11 @@ type User_Extension struct {
 type Profile_Extension struct {
 	City    string
 	Country string
+	Gender  string `yep:"selection_add(other|Other)"`
 }
 
 type Tag_Extension struct {
 	Description string
+	Active      bool
+	Color       string `yep:"selection_add(black|Black)"`
 }
@@ -0,0 +1,124 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestOperators(t *testing.T) {
+	Convey("Testing the operators of the database adapter", t, func() {
+		if DBARGS.Driver == "postgres" {
+			userMI, _ := modelRegistry.get("User")
+			name, _ := userMI.fields.get("user_name")
+			profile, _ := userMI.fields.get("profile_id")
+			isStaff, _ := userMI.fields.get("is_staff")
+			profileMI, _ := modelRegistry.get("Profile")
+			birthday, _ := profileMI.fields.get("birthday")
+			categoryMI, _ := modelRegistry.get("Category")
+			parent, _ := categoryMI.fields.get("parent_id")
+			type opCase struct {
+				fi   *fieldInfo
+				op   DomainOperator
+				arg  interface{}
+				sql  string
+				args SQLParams
+			}
+			cases := []opCase{
+				{name, OPERATOR_EQUALS, "John", `f = ?`, SQLParams{"John"}},
+				{name, OPERATOR_NOT_EQUALS, "John", `f != ?`, SQLParams{"John"}},
+				{profile, OPERATOR_NOT_EQUALS, int64(3), `(f != ? OR f IS NULL)`, SQLParams{int64(3)}},
+				{profile, OPERATOR_EQUALS, nil, `f IS NULL`, nil},
+				{profile, OPERATOR_EQUALS, false, `f IS NULL`, nil},
+				{profile, OPERATOR_NOT_EQUALS, false, `f IS NOT NULL`, nil},
+				{isStaff, OPERATOR_EQUALS, false, `f = ?`, SQLParams{false}},
+				{name, OPERATOR_EQUALS, false, `(f IS NULL OR f = '')`, nil},
+				{name, OPERATOR_NOT_EQUALS, false, `(f IS NOT NULL AND f != '')`, nil},
+				{birthday, OPERATOR_EQUALS, false, `(f IS NULL OR f = '0001-01-01')`, nil},
+				{birthday, OPERATOR_NOT_EQUALS, nil, `(f IS NOT NULL AND f != '0001-01-01')`, nil},
+				{name, OPERATOR_UNSET_EQUALS, nil, `TRUE`, nil},
+				{name, OPERATOR_UNSET_EQUALS, false, `TRUE`, nil},
+				{name, OPERATOR_UNSET_EQUALS, "John", `f = ?`, SQLParams{"John"}},
+				{name, OPERATOR_LOWER, "M", `f < ?`, SQLParams{"M"}},
+				{name, OPERATOR_LOWER_EQUAL, "M", `f <= ?`, SQLParams{"M"}},
+				{name, OPERATOR_GREATER, "M", `f > ?`, SQLParams{"M"}},
+				{name, OPERATOR_GREATER_EQUAL, "M", `f >= ?`, SQLParams{"M"}},
+				{name, OPERATOR_LIKE, "oh", `f LIKE ?`, SQLParams{"%oh%"}},
+				{name, OPERATOR_NOT_LIKE, "oh", `f NOT LIKE ?`, SQLParams{"%oh%"}},
+				{name, OPERATOR_ILIKE, "oh", `f ILIKE ?`, SQLParams{"%oh%"}},
+				{name, OPERATOR_NOT_ILIKE, "oh", `f NOT ILIKE ?`, SQLParams{"%oh%"}},
+				{name, OPERATOR_LIKE_PATTERN, "J_hn%", `f LIKE ?`, SQLParams{"J_hn%"}},
+				{name, OPERATOR_ILIKE_PATTERN, "j_hn%", `f ILIKE ?`, SQLParams{"j_hn%"}},
+				{name, OPERATOR_IN, []string{"John", "Jane"}, `f IN (?)`, SQLParams{[]interface{}{"John", "Jane"}}},
+				{name, OPERATOR_IN, "John", `f IN (?)`, SQLParams{[]interface{}{"John"}}},
+				{name, OPERATOR_IN, []string{}, `FALSE`, nil},
+				{name, OPERATOR_NOT_IN, []string{}, `TRUE`, nil},
+				{profile, OPERATOR_IN, []interface{}{int64(1), false}, `(f IN (?) OR f IS NULL)`, SQLParams{[]interface{}{int64(1)}}},
+				{profile, OPERATOR_NOT_IN, []interface{}{int64(1), nil}, `(f NOT IN (?) AND f IS NOT NULL)`, SQLParams{[]interface{}{int64(1)}}},
+				{profile, OPERATOR_NOT_IN, []int64{1, 2}, `(f NOT IN (?) OR f IS NULL)`, SQLParams{[]interface{}{int64(1), int64(2)}}},
+				{name, OPERATOR_NOT_IN, []string{"John"}, `f NOT IN (?)`, SQLParams{[]interface{}{"John"}}},
+				{name, OPERATOR_IN, []interface{}{"John", false}, `(f IN (?) OR (f IS NULL OR f = ''))`, SQLParams{[]interface{}{"John"}}},
+				{name, OPERATOR_NOT_IN, []interface{}{"John", nil}, `(f NOT IN (?) AND (f IS NOT NULL AND f != ''))`, SQLParams{[]interface{}{"John"}}},
+				{parent, OPERATOR_NOT_IN, sqlSubquery{sql: "SELECT 1", args: SQLParams{2}}, `(f NOT IN (SELECT 1) OR f IS NULL)`, SQLParams{2}},
+				{name, OPERATOR_IN, sqlSubquery{sql: "SELECT 1", args: SQLParams{2}}, `f IN (SELECT 1)`, SQLParams{2}},
+				{name, OPERATOR_BETWEEN, []string{"A", "M"}, `f BETWEEN ? AND ?`, SQLParams{"A", "M"}},
+				{name, OPERATOR_REGEX, "^J.*n$", `f ~ ?`, SQLParams{"^J.*n$"}},
+				{name, OPERATOR_NOT_REGEX, "^J", `f !~ ?`, SQLParams{"^J"}},
+				{name, OPERATOR_IREGEX, "^j", `f ~* ?`, SQLParams{"^j"}},
+				{name, OPERATOR_NOT_IREGEX, "^j", `f !~* ?`, SQLParams{"^j"}},
+			}
+			for _, c := range cases {
+				sql, args := testAdapter.operatorSQL("f", c.op, c.fi, c.arg)
+				So(sql, ShouldEqual, c.sql)
+				So(args, ShouldResemble, c.args)
+			}
+			Convey("Invalid arguments should panic", func() {
+				So(func() { testAdapter.operatorSQL("f", OPERATOR_LOWER, name, nil) }, ShouldPanic)
+				So(func() { testAdapter.operatorSQL("f", OPERATOR_BETWEEN, name, "A") }, ShouldPanic)
+			})
+			Convey("Operators should be applied in searches", func() {
+				env := NewEnvironment(1)
+				env.Pool("User").Create(FieldMap{"UserName": "Operator Test", "Email": "op@example.com"})
+				users := env.Pool("User").Filter("Email", "=", "op@example.com")
+				So(users.Filter("ID", "in", []int64{}).SearchCount(), ShouldEqual, 0)
+				So(users.Filter("ID", "not in", []int64{}).SearchCount(), ShouldEqual, 1)
+				So(users.Filter("Profile", "=", nil).SearchCount(), ShouldEqual, 1)
+				So(users.Filter("Profile", "!=", false).SearchCount(), ShouldEqual, 0)
+				So(users.Filter("Profile", "!=", int64(1)).SearchCount(), ShouldEqual, 1)
+				So(users.Filter("UserName", "=?", false).SearchCount(), ShouldEqual, 1)
+				So(users.Filter("Email2", "=", false).SearchCount(), ShouldEqual, 1)
+				So(users.Filter("Email2", "!=", false).SearchCount(), ShouldEqual, 0)
+				So(users.Filter("UserName", "!=", false).SearchCount(), ShouldEqual, 1)
+				So(users.Filter("Profile.Birthday", "=", false).SearchCount(), ShouldEqual, 1)
+				profile := env.Pool("Profile").Create(FieldMap{"Age": 33})
+				So(profile.Filter("Birthday", "=", false).SearchCount(), ShouldEqual, 1)
+				So(profile.Filter("Birthday", "!=", false).SearchCount(), ShouldEqual, 0)
+				So(users.Filter("UserName", "between", []string{"Operator", "Operator Z"}).SearchCount(), ShouldEqual, 1)
+				So(users.Filter("UserName", "=~", "^Op.*Test$").SearchCount(), ShouldEqual, 1)
+				So(users.Filter("UserName", "=like", "Operator%").SearchCount(), ShouldEqual, 1)
+				So(users.Filter("UserName", "=like", "Test").SearchCount(), ShouldEqual, 0)
+				root := env.Pool("Category").Create(FieldMap{"Name": "Operator Root"})
+				env.Pool("Category").Create(FieldMap{"Name": "Operator Child", "Parent": root.ID()})
+				env.Pool("Category").Create(FieldMap{"Name": "Operator Other"})
+				categories := env.Pool("Category").Filter("Name", "like", "Operator")
+				So(categories.Filter("Parent", "not child_of", root.ID()).SearchCount(), ShouldEqual, 2)
+				So(categories.Filter("ID", "not child_of", root.ID()).SearchCount(), ShouldEqual, 1)
+				env.cr.Rollback()
+			})
+		}
+	})
+}
@@ -0,0 +1,93 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func onchangeIsStaff(rs RecordSet) OnchangeResult {
+	return OnchangeResult{
+		Value:   FieldMap{"Nums": 10},
+		Warning: &OnchangeWarning{Title: "Staff", Message: "Staff members can edit all posts"},
+		Domain:  map[string]Domain{"Profile": {[]interface{}{"Age", ">=", 18}}},
+	}
+}
+
+func onchangeNums(rs RecordSet) OnchangeResult {
+	return OnchangeResult{
+		Warning: &OnchangeWarning{Title: "Nums", Message: "Nums have changed"},
+	}
+}
+
+func TestOnchange(t *testing.T) {
+	Convey("Testing onchange on pseudo-records", t, func() {
+		env := NewEnvironment(1)
+		var userWill User_Simple
+		env.Pool("User").Filter("Email", "=", "will.smith@example.com").RelatedDepth(1).ReadOne(&userWill)
+		Convey("Setting a profile on a new user should compute its age", func() {
+			res := env.Pool("User").Call("Onchange", OnchangeParams{
+				Values: FieldMap{
+					"user_name":  "Nancy Smith",
+					"email":      "nancy.smith@example.com",
+					"profile_id": float64(userWill.Profile.ID),
+				},
+				Fields: []string{"profile_id"},
+			}).(OnchangeResult)
+			So(res.Value["age"], ShouldEqual, 34)
+			So(res.Value["p_money"], ShouldEqual, 5100)
+		})
+		Convey("Onchange methods results should be merged", func() {
+			res := env.Pool("User").Call("Onchange", OnchangeParams{
+				Values: FieldMap{
+					"user_name": "Nancy Smith",
+					"is_staff":  true,
+				},
+				Fields: []string{"is_staff", "nums"},
+			}).(OnchangeResult)
+			So(res.Value["nums"], ShouldEqual, 10)
+			So(res.Warning, ShouldNotBeNil)
+			So(res.Warning.Title, ShouldEqual, "Staff")
+			So(res.Warning.Message, ShouldEqual, "Staff members can edit all posts\n\nNums have changed")
+			So(res.Domain, ShouldContainKey, "profile_id")
+			So(res.Domain["profile_id"], ShouldResemble, Domain{[]interface{}{"Age", ">=", 18}})
+		})
+		Convey("Onchange on an empty form should not fail", func() {
+			res := env.Pool("User").Call("Onchange", OnchangeParams{
+				Values: FieldMap{"email": nil},
+				Fields: []string{"email"},
+			}).(OnchangeResult)
+			So(res.Warning, ShouldBeNil)
+		})
+		Convey("Nested pseudo-records should all be rolled back", func() {
+			var innerCount int
+			env.Pool("User").withPseudoRecord(FieldMap{"user_name": "Outer Nancy"}, func(outer *RecordSet) {
+				env.Pool("User").withPseudoRecord(FieldMap{"user_name": "Inner Nancy"}, func(inner *RecordSet) {
+					innerCount = env.Pool("User").Filter("UserName", "like", "Nancy").SearchCount()
+				})
+				So(env.Pool("User").Filter("UserName", "=", "Inner Nancy").SearchCount(), ShouldEqual, 0)
+				So(env.Pool("User").Filter("UserName", "=", "Outer Nancy").SearchCount(), ShouldEqual, 1)
+			})
+			So(innerCount, ShouldEqual, 2)
+			So(env.Pool("User").Filter("UserName", "like", "Nancy").SearchCount(), ShouldEqual, 0)
+		})
+		Convey("Onchange should not create any record", func() {
+			So(env.Pool("User").Filter("UserName", "=", "Nancy Smith").SearchCount(), ShouldEqual, 0)
+		})
+		env.cr.Rollback()
+	})
+}
@@ -0,0 +1,64 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"testing"
+
+	"github.com/npiganeau/yep/yep/tools"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func tagColors(rs RecordSet) Selection {
+	return Selection{{"red", "Red"}, {"blue", "Blue"}}
+}
+
+func TestSelection(t *testing.T) {
+	Convey("Testing selection fields", t, func() {
+		env := NewEnvironment(1)
+		Convey("Selection should include options added by extensions", func() {
+			fInfos := env.Pool("Profile").Call("FieldsGet", FieldsGetArgs{AllFields: []string{"gender"}}).(map[string]*FieldInfo)
+			So(fInfos["gender"].Type, ShouldEqual, tools.SELECTION)
+			So(fInfos["gender"].Selection, ShouldResemble, Selection{{"male", "Male"}, {"female", "Female"}, {"other", "Other"}})
+		})
+		Convey("Selection methods results should include options added by extensions", func() {
+			fInfos := env.Pool("Tag").Call("FieldsGet", FieldsGetArgs{AllFields: []string{"color"}}).(map[string]*FieldInfo)
+			So(fInfos["color"].Type, ShouldEqual, tools.SELECTION)
+			So(fInfos["color"].Selection, ShouldResemble, Selection{{"red", "Red"}, {"blue", "Blue"}, {"black", "Black"}})
+			So(func() { env.Pool("Tag").Create(FieldMap{"Name": "Colored", "Color": "black"}) }, ShouldNotPanic)
+			So(func() { env.Pool("Tag").Create(FieldMap{"Name": "Colored", "Color": "green"}) }, ShouldPanic)
+		})
+		Convey("Fields declared with selection_add only should have the added options", func() {
+			fInfos := env.Pool("Category").Call("FieldsGet", FieldsGetArgs{AllFields: []string{"kind"}}).(map[string]*FieldInfo)
+			So(fInfos["kind"].Type, ShouldEqual, tools.SELECTION)
+			So(fInfos["kind"].Selection, ShouldResemble, Selection{{"main", "Main"}, {"sub", "Sub"}})
+		})
+		Convey("Selection labels should be translated", func() {
+			tools.AddTranslation("fr_FR", "Female", "Femme")
+			fInfos := env.WithContext(tools.Context{"lang": "fr_FR"}, true).Pool("Profile").Call("FieldsGet", FieldsGetArgs{AllFields: []string{"gender"}}).(map[string]*FieldInfo)
+			So(fInfos["gender"].Selection[1], ShouldResemble, [2]string{"female", "Femme"})
+		})
+		Convey("Valid selection values should be accepted", func() {
+			profile := env.Pool("Profile").Create(FieldMap{"Age": 23, "Gender": "other"})
+			So(len(profile.Ids()), ShouldEqual, 1)
+			So(func() { profile.Write(FieldMap{"Gender": "female"}) }, ShouldNotPanic)
+			So(func() { profile.Write(FieldMap{"Gender": "unknown"}) }, ShouldPanic)
+		})
+		Convey("Invalid selection values should panic", func() {
+			So(func() { env.Pool("Profile").Create(FieldMap{"Age": 23, "Gender": "unknown"}) }, ShouldPanic)
+		})
+		env.cr.Rollback()
+	})
+}
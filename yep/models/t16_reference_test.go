@@ -0,0 +1,60 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"testing"
+
+	"github.com/npiganeau/yep/yep/tools"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReference(t *testing.T) {
+	Convey("Testing reference fields", t, func() {
+		env := NewEnvironment(1)
+		userWill := env.Pool("User").Filter("Email", "=", "will.smith@example.com").Search()
+		willRef := NewReference("User", userWill.Ids()[0])
+		Convey("References should be stored and read back", func() {
+			post := env.Pool("Post").Create(FieldMap{"Title": "Referenced post", "Origin": willRef})
+			var fMap FieldMap
+			post.ReadValue(&fMap, "origin")
+			So(fMap["origin"], ShouldResemble, willRef)
+			So(fMap["origin"].(Reference).ModelName(), ShouldEqual, "User")
+			So(fMap["origin"].(Reference).ID(), ShouldEqual, userWill.Ids()[0])
+		})
+		Convey("References should be resolved through the environment", func() {
+			rec := env.ResolveReference(willRef)
+			So(rec.ModelName(), ShouldEqual, "User")
+			So(rec.Ids(), ShouldResemble, userWill.Ids())
+		})
+		Convey("References should be filterable by model and by record", func() {
+			env.Pool("Post").Create(FieldMap{"Title": "Referenced post", "Origin": willRef.String()})
+			So(env.Pool("Post").Filter("Origin", "=", willRef).SearchCount(), ShouldEqual, 1)
+			So(env.Pool("Post").Filter("Origin", "=", NewReference("User", 0)).SearchCount(), ShouldEqual, 1)
+			So(env.Pool("Post").Filter("Origin", "=", NewReference("Tag", 0)).SearchCount(), ShouldEqual, 0)
+		})
+		Convey("References to models that are not allowed should panic", func() {
+			So(func() {
+				env.Pool("Post").Create(FieldMap{"Title": "Wrong post", "Origin": NewReference("Profile", 1)})
+			}, ShouldPanic)
+		})
+		Convey("Allowed models should be exposed in FieldsGet", func() {
+			fInfos := env.Pool("Post").Call("FieldsGet", FieldsGetArgs{AllFields: []string{"origin"}}).(map[string]*FieldInfo)
+			So(fInfos["origin"].Type, ShouldEqual, tools.REFERENCE)
+			So(fInfos["origin"].Selection, ShouldResemble, Selection{{"User", "User"}, {"Tag", "Tag"}})
+		})
+		env.cr.Rollback()
+	})
+}
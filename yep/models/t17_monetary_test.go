@@ -0,0 +1,82 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"testing"
+
+	"github.com/npiganeau/yep/yep/tools"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDecimalRounding(t *testing.T) {
+	Convey("Testing decimal rounding", t, func() {
+		So(NewDecimal(12345, 3).Round(2).String(), ShouldEqual, "12.35")
+		So(NewDecimal(-12345, 3).Round(2).String(), ShouldEqual, "-12.35")
+		So(NewDecimal(12344, 3).Round(2).String(), ShouldEqual, "12.34")
+		So(NewDecimal(5, 0).Round(2).String(), ShouldEqual, "5.00")
+		So(NewDecimalFromFloat(0.1).String(), ShouldEqual, "0.1")
+		So(NewDecimal(12345, 1).Round(-2).String(), ShouldEqual, "1200")
+		So(NewDecimal(-12551, 1).Round(-1).String(), ShouldEqual, "-1260")
+		So(NewDecimal(12345, 3).Round(-2).String(), ShouldEqual, "0")
+		So(NewDecimal(45, 2).Div(NewDecimal(1, 3), -1).String(), ShouldEqual, "450")
+		dec, err := ParseDecimal("-0.005")
+		So(err, ShouldBeNil)
+		So(dec.Round(2).String(), ShouldEqual, "-0.01")
+		_, err = ParseDecimal("1.2.3")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestMonetary(t *testing.T) {
+	Convey("Testing monetary fields", t, func() {
+		env := NewEnvironment(1)
+		euro := env.Pool("Currency").Create(FieldMap{"Name": "EUR", "DecimalPlaces": 2})
+		dinar := env.Pool("Currency").Create(FieldMap{"Name": "KWD", "DecimalPlaces": 3})
+		Convey("Monetary values should be rounded with their currency on create", func() {
+			profile := env.Pool("Profile").Create(FieldMap{"Currency": dinar.ID(), "Balance": "10.12345"})
+			var fMap FieldMap
+			profile.ReadValue(&fMap, "balance")
+			So(fMap["balance"].(Decimal).String(), ShouldEqual, "10.123")
+			So(profile.MonetaryScale("Balance"), ShouldEqual, 3)
+			So(profile.FormatMonetary("Balance"), ShouldEqual, "10.123")
+		})
+		Convey("Monetary values should be rounded per record on update", func() {
+			p1 := env.Pool("Profile").Create(FieldMap{"Currency": euro.ID()})
+			p2 := env.Pool("Profile").Create(FieldMap{"Currency": dinar.ID()})
+			profiles := env.Pool("Profile").Filter("ID", "in", []int64{p1.ID(), p2.ID()})
+			profiles.Write(FieldMap{"Balance": 3.14159})
+			So(p1.FormatMonetary("Balance"), ShouldEqual, "3.14")
+			So(p2.FormatMonetary("Balance"), ShouldEqual, "3.142")
+		})
+		Convey("Monetary values without currency should use the default precision", func() {
+			profile := env.Pool("Profile").Create(FieldMap{"Balance": 2.005})
+			So(profile.FormatMonetary("Balance"), ShouldEqual, "2.01")
+		})
+		Convey("Currency precision should be exposed in FieldsGet", func() {
+			fInfos := env.WithContext(tools.Context{"currency_id": dinar.ID()}, true).Pool("Profile").
+				Call("FieldsGet", FieldsGetArgs{AllFields: []string{"balance"}}).(map[string]*FieldInfo)
+			So(fInfos["balance"].Type, ShouldEqual, tools.MONETARY)
+			So(fInfos["balance"].CurrencyField, ShouldEqual, "currency_id")
+			So(*fInfos["balance"].Digits, ShouldResemble, tools.Digits{16, 3})
+		})
+		Convey("Unknown currencies should use the default precision", func() {
+			fInfos := env.WithContext(tools.Context{"currency_id": int64(-1)}, true).Pool("Profile").
+				Call("FieldsGet", FieldsGetArgs{AllFields: []string{"balance"}}).(map[string]*FieldInfo)
+			So(*fInfos["balance"].Digits, ShouldResemble, tools.Digits{16, 2})
+		})
+		env.cr.Rollback()
+	})
+}
@@ -0,0 +1,83 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/npiganeau/yep/yep/tools"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDecimalArithmetic(t *testing.T) {
+	Convey("Testing decimal arithmetic", t, func() {
+		a := NewDecimal(110, 1)
+		b := NewDecimal(25, 2)
+		So(a.Add(b).String(), ShouldEqual, "11.25")
+		So(a.Sub(b).String(), ShouldEqual, "10.75")
+		So(a.Mul(b).String(), ShouldEqual, "2.750")
+		So(a.Div(NewDecimal(3, 0), 4).String(), ShouldEqual, "3.6667")
+		So(a.Neg().Abs().Equal(a), ShouldBeTrue)
+		So(a.Cmp(b), ShouldEqual, 1)
+		So(NewDecimal(100, 2).Equal(NewDecimal(1, 0)), ShouldBeTrue)
+		Convey("Decimals should marshal to and from JSON numbers", func() {
+			data, err := json.Marshal(NewDecimal(-1205, 2))
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, "-12.05")
+			var dec Decimal
+			So(json.Unmarshal([]byte(`"0.1"`), &dec), ShouldBeNil)
+			So(dec.String(), ShouldEqual, "0.1")
+		})
+	})
+}
+
+func TestDecimalFields(t *testing.T) {
+	Convey("Testing decimal fields", t, func() {
+		env := NewEnvironment(1)
+		Convey("Decimal fields should be float fields", func() {
+			fInfos := env.Pool("Post").Call("FieldsGet", FieldsGetArgs{AllFields: []string{"rating"}}).(map[string]*FieldInfo)
+			So(fInfos["rating"].Type, ShouldEqual, tools.FLOAT)
+			So(*fInfos["rating"].Digits, ShouldResemble, tools.Digits{5, 2})
+		})
+		Convey("Decimal values should be rounded to their digits and read back exactly", func() {
+			post := env.Pool("Post").Create(FieldMap{"Title": "Decimal post", "Rating": 1.235})
+			var fMap FieldMap
+			post.ReadValue(&fMap, "rating")
+			So(fMap["rating"].(Decimal).String(), ShouldEqual, "1.24")
+		})
+		Convey("Float values with digits should be rounded to their digits", func() {
+			fInfos := env.Pool("Post").Call("FieldsGet", FieldsGetArgs{AllFields: []string{"score"}}).(map[string]*FieldInfo)
+			So(*fInfos["score"].Digits, ShouldResemble, tools.Digits{4, 1})
+			post := env.Pool("Post").Create(FieldMap{"Title": "Float post", "Score": 2.25})
+			var fMap FieldMap
+			post.ReadValue(&fMap, "score")
+			So(fMap["score"], ShouldEqual, 2.3)
+			post.Write(FieldMap{"Score": 7.049})
+			post.ReadValue(&fMap, "score")
+			So(fMap["score"], ShouldEqual, 7.0)
+		})
+		Convey("Aggregates should be returned as Decimal", func() {
+			env.Pool("Post").Create(FieldMap{"Title": "Decimal post", "Rating": "0.10"})
+			env.Pool("Post").Create(FieldMap{"Title": "Decimal post", "Rating": "0.20"})
+			groups := env.Pool("Post").Filter("Title", "=", "Decimal post").GroupBy("Title").ReadGroup("Rating")
+			So(groups, ShouldHaveLength, 1)
+			So(groups[0]["title"], ShouldEqual, "Decimal post")
+			So(groups[0]["__count"], ShouldEqual, 2)
+			So(groups[0]["rating"].(Decimal).String(), ShouldEqual, "0.30")
+		})
+		env.cr.Rollback()
+	})
+}
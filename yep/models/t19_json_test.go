@@ -0,0 +1,94 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"testing"
+
+	"github.com/npiganeau/yep/yep/tools"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestJSONFields(t *testing.T) {
+	Convey("Testing JSON fields", t, func() {
+		env := NewEnvironment(1)
+		meta := map[string]interface{}{
+			"color":   "red",
+			"size":    3,
+			"address": map[string]interface{}{"city": "Paris"},
+		}
+		post := env.Pool("Post").Create(FieldMap{"Title": "JSON post", "Meta": meta})
+		env.Pool("Post").Create(FieldMap{"Title": "JSON post", "Meta": map[string]interface{}{"size": 10}})
+		Convey("Maps should be JSON fields", func() {
+			fInfos := env.Pool("Post").Call("FieldsGet", FieldsGetArgs{AllFields: []string{"meta"}}).(map[string]*FieldInfo)
+			So(fInfos["meta"].Type, ShouldEqual, tools.JSON)
+		})
+		Convey("JSON values should be stored and read back", func() {
+			var fMap FieldMap
+			post.ReadValue(&fMap, "meta")
+			So(fMap["meta"], ShouldResemble, map[string]interface{}{
+				"color":   "red",
+				"size":    float64(3),
+				"address": map[string]interface{}{"city": "Paris"},
+			})
+		})
+		Convey("JSON documents given as strings should be accepted", func() {
+			post.Write(FieldMap{"Meta": `{"color": "blue"}`})
+			var fMap FieldMap
+			post.ReadValue(&fMap, "meta")
+			So(fMap["meta"], ShouldResemble, map[string]interface{}{"color": "blue"})
+		})
+		Convey("JSON paths should be filterable", func() {
+			posts := env.Pool("Post").Filter("Title", "=", "JSON post")
+			So(posts.Filter("Meta.color", "=", "red").SearchCount(), ShouldEqual, 1)
+			So(posts.Filter("Meta.color", "=", "blue").SearchCount(), ShouldEqual, 0)
+			So(posts.Filter("Meta.size", "=", 3).SearchCount(), ShouldEqual, 1)
+			So(posts.Filter("Meta.address.city", "=", "Paris").SearchCount(), ShouldEqual, 1)
+		})
+		Convey("JSON numbers should be compared as numbers", func() {
+			posts := env.Pool("Post").Filter("Title", "=", "JSON post")
+			So(posts.Filter("Meta.size", ">", 9).SearchCount(), ShouldEqual, 1)
+			So(posts.Filter("Meta.size", "<", 9).SearchCount(), ShouldEqual, 1)
+			So(posts.Filter("Meta.size", "between", []int{2, 11}).SearchCount(), ShouldEqual, 2)
+			So(posts.Filter("Meta.size", "in", []float64{3, 4}).SearchCount(), ShouldEqual, 1)
+			So(posts.Filter("Meta.color", ">", 1).SearchCount(), ShouldEqual, 0)
+		})
+		Convey("Structs and slices should be JSON fields with filterable paths", func() {
+			layoutPost := env.Pool("Post").Create(FieldMap{
+				"Title":    "JSON layout post",
+				"Layout":   PostLayout{Theme: "dark", Columns: 2},
+				"Keywords": []string{"go", "orm"},
+			})
+			var fMap FieldMap
+			layoutPost.ReadValue(&fMap, "layout", "keywords")
+			So(fMap["layout"], ShouldResemble, PostLayout{Theme: "dark", Columns: 2})
+			So(fMap["keywords"], ShouldResemble, []string{"go", "orm"})
+			posts := env.Pool("Post").Filter("Title", "=", "JSON layout post")
+			So(posts.Filter("Layout.theme", "=", "dark").SearchCount(), ShouldEqual, 1)
+			So(posts.Filter("Layout.columns", ">=", 2).SearchCount(), ShouldEqual, 1)
+			So(posts.Filter("Layout.columns", ">", 10).SearchCount(), ShouldEqual, 0)
+			So(posts.Filter("Keywords.0", "=", "go").SearchCount(), ShouldEqual, 1)
+			So(posts.Filter("Keywords", "has_key", "orm").SearchCount(), ShouldEqual, 1)
+			So(posts.Filter("Keywords", "has_key", "sql").SearchCount(), ShouldEqual, 0)
+		})
+		Convey("JSON keys existence should be filterable", func() {
+			posts := env.Pool("Post").Filter("Title", "=", "JSON post")
+			So(posts.Filter("Meta", "has_key", "color").SearchCount(), ShouldEqual, 1)
+			So(posts.Filter("Meta.address", "has_key", "city").SearchCount(), ShouldEqual, 1)
+			So(posts.Filter("Meta.address", "has_key", "zip").SearchCount(), ShouldEqual, 0)
+		})
+		env.cr.Rollback()
+	})
+}
@@ -78,3 +78,65 @@ func TestDomains(t *testing.T) {
 	})
 
 }
+
+func TestDomainSerialization(t *testing.T) {
+	Convey("Testing Condition serialization", t, func() {
+		Convey("AND takes precedence over OR", func() {
+			cond := NewCondition().And("UserName", "like", "Smith").And("Age", "=", 24).Or("Email", "ilike", "jane")
+			So(cond.Domain("User"), ShouldResemble, Domain{
+				"|", "&",
+				[]interface{}{"user_name", "like", "Smith"},
+				[]interface{}{"age", "=", 24},
+				[]interface{}{"email", "ilike", "jane"},
+			})
+			So(cond.String(), ShouldEqual, `(UserName like "Smith" AND Age = 24) OR Email ilike "jane"`)
+		})
+		Convey("Nested ANDs should be flattened", func() {
+			cond := NewCondition().And("Age", ">", 12).AndCond(NewCondition().And("Age", "<", 24).And("IsStaff", "=", true))
+			So(cond.Domain("User"), ShouldResemble, Domain{
+				"&", "&",
+				[]interface{}{"age", ">", 12},
+				[]interface{}{"age", "<", 24},
+				[]interface{}{"is_staff", "=", true},
+			})
+			So(cond.String(), ShouldEqual, `Age > 12 AND Age < 24 AND IsStaff = true`)
+		})
+		Convey("NOT should be pushed down to the terms", func() {
+			sub := NewCondition().And("UserName", "like", "Smith").Or("Age", "=", 24)
+			cond := NewCondition().AndNotCond(sub).And("IsStaff", "=", true)
+			So(cond.Domain("User"), ShouldResemble, Domain{
+				"&", "&",
+				"!", []interface{}{"user_name", "like", "Smith"},
+				"!", []interface{}{"age", "=", 24},
+				[]interface{}{"is_staff", "=", true},
+			})
+			So(cond.String(), ShouldEqual, `NOT UserName like "Smith" AND NOT Age = 24 AND IsStaff = true`)
+		})
+		Convey("NOT should invert 'any' operators", func() {
+			cond := NewCondition().AndNot("Posts", "any", NewCondition().And("Title", "=", "foo"))
+			So(cond.Domain("User"), ShouldResemble, Domain{
+				[]interface{}{"posts_ids", "not any", Domain{[]interface{}{"title", "=", "foo"}}},
+			})
+		})
+		Convey("Domains should be parsed back into equivalent conditions", func() {
+			dom := Domain{
+				"|", "!", []interface{}{"user_name", "like", "Will"},
+				"&", []interface{}{"age", ">", 0}, []interface{}{"age", "<", 25},
+			}
+			So(ParseDomain(dom).Domain("User"), ShouldResemble, dom)
+			So(ParseDomain(Domain{"!", "|", []interface{}{"Age", "=", 1}, []interface{}{"Age", "=", 2}}).String(), ShouldEqual, `NOT Age = 1 AND NOT Age = 2`)
+		})
+		Convey("Paths should be given with JSON names", func() {
+			cond := NewCondition().And("Profile.BestPost.Title", "=", "foo").And("Posts.User.UserName", "like", "Smith")
+			So(cond.Domain("User"), ShouldResemble, Domain{
+				"&",
+				[]interface{}{"profile_id.best_post_id.title", "=", "foo"},
+				[]interface{}{"posts_ids.user_id.user_name", "like", "Smith"},
+			})
+		})
+		Convey("Empty conditions should give an empty domain", func() {
+			So(NewCondition().Domain("User"), ShouldBeEmpty)
+			So(NewCondition().String(), ShouldEqual, "")
+		})
+	})
+}
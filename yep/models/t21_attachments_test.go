@@ -0,0 +1,78 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/npiganeau/yep/yep/tools"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAttachments(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "yep-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+	tools.Config.Set("DataDir", dataDir)
+
+	Convey("Testing attachment fields", t, func() {
+		env := NewEnvironment(1)
+		content := "Hello attachments!"
+		profile := env.Pool("Profile").Create(FieldMap{"Age": 40, "Resume": base64.StdEncoding.EncodeToString([]byte(content))})
+		Convey("Only the checksum should be stored in database", func() {
+			info := profile.BinaryInfo("Resume")
+			So(info.Checksum, ShouldEqual, "534334d354dae7c8bcf1f1fdbaf84e4db262ed12")
+			So(info.Size, ShouldEqual, len(content))
+			So(info.MimeType, ShouldStartWith, "text/plain")
+			_, err := os.Stat(dataDir + "/filestore/53/" + info.Checksum)
+			So(err, ShouldBeNil)
+		})
+		Convey("Content should be read back as base64 or as size", func() {
+			var fMap FieldMap
+			profile.ReadValue(&fMap, "resume")
+			So(fMap["resume"], ShouldEqual, base64.StdEncoding.EncodeToString([]byte(content)))
+			profile.Env().WithContext(tools.Context{"bin_size": true}, true).Pool("Profile").
+				Filter("ID", "=", profile.ID()).ReadValue(&fMap, "resume")
+			So(fMap["resume"], ShouldEqual, "18.00 bytes")
+		})
+		Convey("Content should be streamed", func() {
+			profile.WriteBinary("Resume", strings.NewReader("Streamed content"))
+			reader, info := profile.ReadBinary("Resume")
+			So(reader, ShouldNotBeNil)
+			data, _ := ioutil.ReadAll(reader)
+			reader.Close()
+			So(string(data), ShouldEqual, "Streamed content")
+			So(info.Size, ShouldEqual, 16)
+		})
+		Convey("Unreferenced files should be garbage collected", func() {
+			checksum := profile.BinaryInfo("Resume").Checksum
+			profile.Write(FieldMap{"Resume": ""})
+			env.cr.Commit()
+			So(CollectAttachmentsGarbage(0), ShouldBeGreaterThanOrEqualTo, 1)
+			_, err := os.Stat(dataDir + "/filestore/53/" + checksum)
+			So(os.IsNotExist(err), ShouldBeTrue)
+			env = NewEnvironment(1)
+			env.Pool("Profile").Filter("ID", "=", profile.ID()).Call("Unlink")
+			env.cr.Commit()
+		})
+		env.cr.Rollback()
+	})
+}
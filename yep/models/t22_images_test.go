@@ -0,0 +1,85 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/npiganeau/yep/yep/tools"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestImages(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "yep-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+	tools.Config.Set("DataDir", dataDir)
+
+	img := image.NewRGBA(image.Rect(0, 0, 100, 50))
+	for x := 0; x < 100; x++ {
+		for y := 0; y < 50; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	imgData := base64.StdEncoding.EncodeToString(buf.Bytes())
+
+	Convey("Testing image fields", t, func() {
+		env := NewEnvironment(1)
+		Convey("Resized variants should be exposed as read-only image fields", func() {
+			fInfos := env.Pool("Profile").Call("FieldsGet", FieldsGetArgs{AllFields: []string{"avatar", "avatar_64", "avatar_16"}}).(map[string]*FieldInfo)
+			So(fInfos["avatar"].Type, ShouldEqual, tools.IMAGE)
+			So(fInfos["avatar"].ReadOnly, ShouldBeFalse)
+			So(fInfos["avatar_64"].Type, ShouldEqual, tools.IMAGE)
+			So(fInfos["avatar_64"].ReadOnly, ShouldBeTrue)
+			So(fInfos["avatar_16"].ReadOnly, ShouldBeTrue)
+		})
+		Convey("Resized variants should be generated on write", func() {
+			profile := env.Pool("Profile").Create(FieldMap{"Age": 12, "Avatar": imgData})
+			var fMap FieldMap
+			profile.ReadValue(&fMap, "avatar", "avatar_64", "avatar_16")
+			So(fMap["avatar"], ShouldEqual, imgData)
+			for field, size := range map[string][2]int{"avatar_64": {64, 32}, "avatar_16": {16, 8}} {
+				data, err := base64.StdEncoding.DecodeString(fMap[field].(string))
+				So(err, ShouldBeNil)
+				cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+				So(err, ShouldBeNil)
+				So(format, ShouldEqual, "png")
+				So([2]int{cfg.Width, cfg.Height}, ShouldResemble, size)
+			}
+			profile.Write(FieldMap{"Avatar": ""})
+			So(profile.BinaryInfo("Avatar64").Checksum, ShouldBeEmpty)
+		})
+		Convey("Invalid images should be rejected", func() {
+			So(func() {
+				env.Pool("Profile").Create(FieldMap{"Age": 12, "Avatar": base64.StdEncoding.EncodeToString([]byte("not an image"))})
+			}, ShouldPanic)
+		})
+		Convey("Resized variants should not be writable", func() {
+			So(func() { env.Pool("Profile").Create(FieldMap{"Age": 12, "Avatar64": imgData}) }, ShouldPanic)
+		})
+		env.cr.Rollback()
+	})
+}
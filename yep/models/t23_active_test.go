@@ -0,0 +1,82 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"testing"
+
+	"github.com/npiganeau/yep/yep/tools"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type Tag_WithActive struct {
+	ID     int64
+	Name   string
+	Active bool
+}
+
+type Tag_WithoutActive struct {
+	ID   int64
+	Name string
+}
+
+func TestActive(t *testing.T) {
+	Convey("Testing archiving with the Active field", t, func() {
+		env := NewEnvironment(1)
+		tag := env.Pool("Tag").Create(FieldMap{"Name": "Archived Tag"})
+		Convey("New records should be active by default", func() {
+			So(env.Pool("Tag").Filter("Name", "=", "Archived Tag").SearchCount(), ShouldEqual, 1)
+		})
+		Convey("Records created from a struct without Active field should be active", func() {
+			env.Pool("Tag").Create(&Tag_WithoutActive{Name: "Struct Tag"})
+			So(env.Pool("Tag").Filter("Name", "=", "Struct Tag").SearchCount(), ShouldEqual, 1)
+		})
+		Convey("Records created from a struct should keep their Active value", func() {
+			env.Pool("Tag").Create(&Tag_WithActive{Name: "Struct Tag", Active: true})
+			env.Pool("Tag").Create(&Tag_WithActive{Name: "Struct Tag", Active: false})
+			So(env.Pool("Tag").Filter("Name", "=", "Struct Tag").SearchCount(), ShouldEqual, 1)
+			So(env.Pool("Tag").Filter("Name", "=", "Struct Tag").Filter("Active", "=", false).SearchCount(), ShouldEqual, 1)
+		})
+		Convey("Archived records should not be searched", func() {
+			So(tag.Archive(), ShouldBeTrue)
+			So(env.Pool("Tag").Filter("Name", "=", "Archived Tag").SearchCount(), ShouldEqual, 0)
+			So(env.Pool("Tag").Filter("Name", "=", "Archived Tag").Search().Ids(), ShouldBeEmpty)
+		})
+		Convey("Archived records should be found when the condition mentions Active", func() {
+			tag.Archive()
+			So(env.Pool("Tag").Filter("Name", "=", "Archived Tag").Filter("Active", "=", false).SearchCount(), ShouldEqual, 1)
+		})
+		Convey("Archived records should be found with active_test set to false", func() {
+			tag.Archive()
+			ctxEnv := env.WithContext(tools.Context{"active_test": false}, true)
+			So(ctxEnv.Pool("Tag").Filter("Name", "=", "Archived Tag").SearchCount(), ShouldEqual, 1)
+		})
+		Convey("Archived records should still be readable by id", func() {
+			tag.Archive()
+			var fMap FieldMap
+			tag.ReadValue(&fMap, "Name")
+			So(fMap["name"], ShouldEqual, "Archived Tag")
+		})
+		Convey("Unarchived records should be searched again", func() {
+			tag.Archive()
+			So(tag.Unarchive(), ShouldBeTrue)
+			So(env.Pool("Tag").Filter("Name", "=", "Archived Tag").SearchCount(), ShouldEqual, 1)
+		})
+		Convey("Archiving a model without Active field should panic", func() {
+			So(func() { env.Pool("Currency").Archive() }, ShouldPanic)
+		})
+		env.cr.Rollback()
+	})
+}
@@ -0,0 +1,98 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHierarchy(t *testing.T) {
+	Convey("Testing hierarchical models", t, func() {
+		env := NewEnvironment(1)
+		root := env.Pool("Category").Create(FieldMap{"Name": "Root"})
+		child := env.Pool("Category").Create(FieldMap{"Name": "Child", "Parent": root.ID()})
+		grandChild := env.Pool("Category").Create(FieldMap{"Name": "GrandChild", "Parent": child.ID()})
+		other := env.Pool("Category").Create(FieldMap{"Name": "Other"})
+		Convey("Parent paths should be set on create", func() {
+			var fMap FieldMap
+			grandChild.ReadValue(&fMap, "ParentPath")
+			So(fMap["parent_path"], ShouldEqual, fmt.Sprintf("%d/%d/%d/", root.ID(), child.ID(), grandChild.ID()))
+		})
+		Convey("child_of should return the records and their descendants", func() {
+			ids := env.Pool("Category").Filter("ID", "child_of", child.ID()).Search().Ids()
+			So(ids, ShouldHaveLength, 2)
+			So(ids, ShouldContain, child.ID())
+			So(ids, ShouldContain, grandChild.ID())
+		})
+		Convey("parent_of should return the records and their ancestors", func() {
+			ids := env.Pool("Category").Filter("ID", "parent_of", grandChild.ID()).Search().Ids()
+			So(ids, ShouldHaveLength, 3)
+			So(ids, ShouldNotContain, other.ID())
+		})
+		Convey("child_of should work on many2one fields", func() {
+			So(env.Pool("Category").Filter("Parent", "child_of", root.ID()).SearchCount(), ShouldEqual, 2)
+		})
+		Convey("Changing the parent should update the paths of the descendants", func() {
+			child.Write(FieldMap{"Parent": other.ID()})
+			So(env.Pool("Category").Filter("ID", "child_of", other.ID()).SearchCount(), ShouldEqual, 3)
+			So(env.Pool("Category").Filter("ID", "child_of", root.ID()).SearchCount(), ShouldEqual, 1)
+		})
+		Convey("Changing the parent of a filtered RecordSet should only update its records", func() {
+			env.Pool("Category").Filter("Name", "=", "Child").Write(FieldMap{"Parent": other.ID()})
+			So(env.Pool("Category").Filter("Parent", "=", other.ID()).Search().Ids(), ShouldResemble, []int64{child.ID()})
+			So(env.Pool("Category").Filter("Parent", "=", child.ID()).Search().Ids(), ShouldResemble, []int64{grandChild.ID()})
+			So(env.Pool("Category").Filter("ID", "child_of", other.ID()).SearchCount(), ShouldEqual, 3)
+			So(env.Pool("Category").Filter("ID", "child_of", root.ID()).SearchCount(), ShouldEqual, 1)
+		})
+		Convey("Creating a cycle should panic", func() {
+			So(func() { root.Write(FieldMap{"Parent": grandChild.ID()}) }, ShouldPanic)
+			So(func() { root.Write(FieldMap{"Parent": root.ID()}) }, ShouldPanic)
+		})
+		Convey("ParentPath should not be writable", func() {
+			So(func() { root.Write(FieldMap{"ParentPath": "1/"}) }, ShouldPanic)
+		})
+		env.cr.Rollback()
+	})
+}
+
+func TestHierarchyParentPathsFill(t *testing.T) {
+	Convey("Testing the computation of missing parent paths", t, func() {
+		var rootID, childID, grandChildID int64
+		dbGetNoTx(&rootID, `INSERT INTO category (name, parent_path) VALUES ('Old Root', '') RETURNING id`)
+		dbGetNoTx(&childID, `INSERT INTO category (name, parent_id, parent_path) VALUES ('Old Child', ?, '') RETURNING id`, rootID)
+		dbGetNoTx(&grandChildID, `INSERT INTO category (name, parent_id, parent_path) VALUES ('Old GrandChild', ?, '') RETURNING id`, childID)
+		mi, _ := modelRegistry.get("Category")
+		fillParentPaths(mi)
+		env := NewEnvironment(1)
+		Convey("Records without parent path should get one at bootstrap", func() {
+			var fMap FieldMap
+			env.Pool("Category").withIds([]int64{grandChildID}).ReadValue(&fMap, "ParentPath")
+			So(fMap["parent_path"], ShouldEqual, fmt.Sprintf("%d/%d/%d/", rootID, childID, grandChildID))
+			So(env.Pool("Category").Filter("ID", "child_of", rootID).SearchCount(), ShouldEqual, 3)
+			So(env.Pool("Category").Filter("ID", "parent_of", grandChildID).SearchCount(), ShouldEqual, 3)
+		})
+		Convey("Moving an old record should move its subtree", func() {
+			other := env.Pool("Category").Create(FieldMap{"Name": "New Root"})
+			env.Pool("Category").withIds([]int64{childID}).Write(FieldMap{"Parent": other.ID()})
+			So(env.Pool("Category").Filter("ID", "child_of", other.ID()).SearchCount(), ShouldEqual, 3)
+			So(env.Pool("Category").Filter("ID", "child_of", rootID).SearchCount(), ShouldEqual, 1)
+		})
+		env.cr.Rollback()
+		dbExecuteNoTx(`DELETE FROM category WHERE id IN (?, ?, ?)`, grandChildID, childID, rootID)
+	})
+}
@@ -0,0 +1,99 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestX2ManyConditions(t *testing.T) {
+	Convey("Testing conditions through x2many fields", t, func() {
+		env := NewEnvironment(1)
+		alice := env.Pool("User").Create(FieldMap{"UserName": "Alice Writer", "Email": "alice@example.com"})
+		bob := env.Pool("User").Create(FieldMap{"UserName": "Bob Writer", "Email": "bob@example.com"})
+		env.Pool("Post").Create(FieldMap{"Title": "Go tips", "User": alice.ID()})
+		env.Pool("Post").Create(FieldMap{"Title": "More go tips", "User": alice.ID()})
+		env.Pool("Post").Create(FieldMap{"Title": "Cooking", "User": bob.ID()})
+		writers := env.Pool("User").Filter("UserName", "like", "Writer")
+		Convey("Conditions on one2many paths should not return duplicates", func() {
+			ids := writers.Filter("Posts.Title", "ilike", "go").Search().Ids()
+			So(ids, ShouldResemble, []int64{alice.ID()})
+		})
+		Convey("Conditions on one2many paths should follow many2one fields", func() {
+			So(env.Pool("User").Filter("Posts.User.Email", "=", "bob@example.com").SearchCount(), ShouldEqual, 1)
+		})
+		Convey("Negated conditions should match records with no matching related record", func() {
+			So(writers.Exclude("Posts.Title", "ilike", "go").Search().Ids(), ShouldResemble, []int64{bob.ID()})
+		})
+		Convey("'any' should take a nested condition", func() {
+			cond := NewCondition().And("Title", "ilike", "go").And("Title", "ilike", "more")
+			So(writers.Filter("Posts", "any", cond).Search().Ids(), ShouldResemble, []int64{alice.ID()})
+		})
+		Convey("'not any' should match records without matching related record", func() {
+			cond := NewCondition().And("Title", "=", "Cooking")
+			So(writers.Filter("Posts", "not any", cond).Search().Ids(), ShouldResemble, []int64{alice.ID()})
+		})
+		Convey("'any' should work on many2one fields", func() {
+			cond := NewCondition().And("Email", "=", "alice@example.com")
+			So(env.Pool("Post").Filter("User", "any", cond).SearchCount(), ShouldEqual, 2)
+		})
+		Convey("'any' should accept a domain", func() {
+			dom := Domain{[]interface{}{"title", "=", "Cooking"}}
+			So(writers.Filter("Posts", "any", dom).Search().Ids(), ShouldResemble, []int64{bob.ID()})
+		})
+		Convey("Conditions on many2many paths should use the link table", func() {
+			goTag := env.Pool("Tag").Create(FieldMap{"Name": "golang"})
+			cookTag := env.Pool("Tag").Create(FieldMap{"Name": "cooking"})
+			posts := env.Pool("Post").Filter("User.UserName", "like", "Writer")
+			for _, post := range posts.Filter("Title", "ilike", "go").Search().Records() {
+				DBExecute(env.cr, `INSERT INTO post_tag_rel (tag_id, post_id) VALUES (?, ?)`, goTag.ID(), post.ID())
+			}
+			cooking := posts.Filter("Title", "=", "Cooking").Search()
+			DBExecute(env.cr, `INSERT INTO post_tag_rel (tag_id, post_id) VALUES (?, ?)`, cookTag.ID(), cooking.ID())
+			tags := env.Pool("Tag").Filter("Name", "in", []string{"golang", "cooking"})
+			So(tags.Filter("Posts.Title", "ilike", "go").Search().Ids(), ShouldResemble, []int64{goTag.ID()})
+			So(tags.Filter("Posts.User.Email", "=", "bob@example.com").Search().Ids(), ShouldResemble, []int64{cookTag.ID()})
+			cond := NewCondition().And("Title", "=", "Cooking")
+			So(tags.Filter("Posts", "not any", cond).Search().Ids(), ShouldResemble, []int64{goTag.ID()})
+		})
+		env.cr.Rollback()
+	})
+}
+
+func TestReverseFieldsForeignKey(t *testing.T) {
+	Convey("Testing foreign keys of reverse fields", t, func() {
+		Convey("Many2many fields should share their link table", func() {
+			tagMI, _ := modelRegistry.get("Tag")
+			fi, _ := tagMI.fields.get("Posts")
+			So(fi.m2mRelTable, ShouldEqual, "post_tag_rel")
+			So(fi.m2mOurField, ShouldEqual, "tag_id")
+			So(fi.m2mTheirField, ShouldEqual, "post_id")
+		})
+		Convey("Reverse fields should resolve their foreign key", func() {
+			userMI, _ := modelRegistry.get("User")
+			fi, _ := userMI.fields.get("Posts")
+			So(fi.foreignKey(), ShouldEqual, "user_id")
+		})
+		Convey("Unresolved foreign keys should only panic when used", func() {
+			userMI, _ := modelRegistry.get("User")
+			fi, _ := userMI.fields.get("Posts")
+			unresolved := *fi
+			unresolved.reverseFK = ""
+			So(func() { unresolved.foreignKey() }, ShouldPanic)
+		})
+	})
+}
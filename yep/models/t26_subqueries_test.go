@@ -0,0 +1,49 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSubqueries(t *testing.T) {
+	Convey("Testing RecordSets as condition arguments", t, func() {
+		env := NewEnvironment(1)
+		alice := env.Pool("User").Create(FieldMap{"UserName": "Alice Subquery", "Email": "alice.sub@example.com"})
+		bob := env.Pool("User").Create(FieldMap{"UserName": "Bob Subquery", "Email": "bob.sub@example.com"})
+		env.Pool("Post").Create(FieldMap{"Title": "Alice's post", "User": alice.ID()})
+		env.Pool("Post").Create(FieldMap{"Title": "Bob's post", "User": bob.ID()})
+		users := env.Pool("User").Filter("Email", "=", "alice.sub@example.com")
+		Convey("RecordSets should be inlined as subqueries", func() {
+			sql, args := env.Pool("Post").Filter("User", "in", users).query.sqlWhereClause()
+			So(sql, ShouldEqual, `WHERE "post".user_id IN (SELECT "user".id AS id FROM "user" "user"  WHERE "user".email = ? ) `)
+			So(args, ShouldResemble, SQLParams{"alice.sub@example.com"})
+		})
+		Convey("'in' with a RecordSet should match the records of the subquery", func() {
+			So(env.Pool("Post").Filter("User", "in", users).Filter("Title", "like", "post").SearchCount(), ShouldEqual, 1)
+			So(env.Pool("User").Filter("ID", "in", users).Search().Ids(), ShouldResemble, []int64{alice.ID()})
+		})
+		Convey("'not in' with a RecordSet should exclude the records of the subquery", func() {
+			posts := env.Pool("Post").Filter("User", "not in", users).Filter("User", "in", []int64{alice.ID(), bob.ID()})
+			So(posts.SearchCount(), ShouldEqual, 1)
+		})
+		Convey("RecordSets of another model should panic", func() {
+			So(func() { env.Pool("Post").Filter("User", "in", env.Pool("Tag")).SearchCount() }, ShouldPanic)
+		})
+		env.cr.Rollback()
+	})
+}
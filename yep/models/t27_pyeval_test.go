@@ -0,0 +1,76 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/npiganeau/yep/yep/tools"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPyEval(t *testing.T) {
+	Convey("Testing Python literal evaluation", t, func() {
+		env := tools.PyEnv{
+			"uid":       int64(1),
+			"active_id": int64(7),
+			"context":   map[string]interface{}{"lang": "fr_FR"},
+		}
+		Convey("Domains should be evaluated with variables", func() {
+			dom := EvalDomain(`['|', ('user_id', '=', uid), ("Title", "ilike", 'foo'), ('id', 'in', [active_id, 3])]`, env)
+			So(dom, ShouldResemble, Domain{
+				"|",
+				[]interface{}{"user_id", "=", int64(1)},
+				[]interface{}{"Title", "ilike", "foo"},
+				[]interface{}{"id", "in", []interface{}{int64(7), int64(3)}},
+			})
+			So(ParseDomain(dom).String(), ShouldEqual, `(user_id = 1 OR Title ilike "foo") AND id in [7 3]`)
+		})
+		Convey("Contexts should be evaluated", func() {
+			ctx, err := tools.EvalPyContext(`{'default_type': 'out', 'active_test': False, 'limit': -5, 'ratio': 1.5, 'lang': context.get('lang'), 'tz': context.get('tz', None)}`, env)
+			So(err, ShouldBeNil)
+			So(ctx, ShouldResemble, tools.Context{
+				"default_type": "out",
+				"active_test":  false,
+				"limit":        int64(-5),
+				"ratio":        1.5,
+				"lang":         "fr_FR",
+				"tz":           nil,
+			})
+		})
+		Convey("Dates should be formatted with strftime", func() {
+			res, err := tools.EvalPy(`context_today().strftime('%Y-%m-%d')`, env)
+			So(err, ShouldBeNil)
+			So(res, ShouldEqual, time.Now().Format("2006-01-02"))
+		})
+		Convey("Empty strings should give empty values", func() {
+			So(EvalDomain("", env), ShouldBeEmpty)
+			ctx, err := tools.EvalPyContext("  ", env)
+			So(err, ShouldBeNil)
+			So(ctx, ShouldBeEmpty)
+		})
+		Convey("Invalid or unsafe expressions should not be evaluated", func() {
+			_, err := tools.EvalPy(`[('a', '=', unknown)]`, env)
+			So(err, ShouldNotBeNil)
+			_, err = tools.EvalPy(`__import__('os').system('ls')`, env)
+			So(err, ShouldNotBeNil)
+			_, err = tools.EvalPy(`[1, 2`, env)
+			So(err, ShouldNotBeNil)
+			So(func() { EvalDomain(`{'a': 1}`, env) }, ShouldPanic)
+		})
+	})
+}
@@ -0,0 +1,125 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestIrFilters(t *testing.T) {
+	Convey("Testing saved search filters", t, func() {
+		env := NewEnvironment(1)
+		filters := env.Pool("IrFilters")
+		private := filters.Call("CreateOrReplace", FieldMap{
+			"name":       "Young users",
+			"model_id":   "user",
+			"user_id":    float64(1),
+			"domain":     []interface{}{[]interface{}{"age", "<", 30}},
+			"context":    map[string]interface{}{"group_by": []interface{}{"nums"}},
+			"is_default": true,
+		}).(*RecordSet)
+		shared := filters.Call("CreateOrReplace", FieldMap{
+			"name":     "Smiths",
+			"model_id": "user",
+			"user_id":  false,
+			"domain":   []interface{}{[]interface{}{"user_name", "ilike", "Smith"}},
+		}).(*RecordSet)
+		filters.Call("CreateOrReplace", FieldMap{
+			"name":     "Other user's filter",
+			"model_id": "user",
+			"user_id":  float64(2),
+		})
+		filters.Call("CreateOrReplace", FieldMap{
+			"name":      "Action filter",
+			"model_id":  "user",
+			"action_id": "other_action",
+		})
+		Convey("Own and shared filters should be returned", func() {
+			res := filters.Call("GetFilters", GetFiltersParams{Model: "user"}).([]*IrFilter)
+			So(res, ShouldHaveLength, 2)
+			So(res[0].Name, ShouldEqual, "Smiths")
+			So(res[0].UserID, ShouldEqual, 0)
+			So(res[1].Name, ShouldEqual, "Young users")
+			So(res[1].ModelID, ShouldEqual, "User")
+			So(res[1].IsDefault, ShouldBeTrue)
+			So(res[1].Domain, ShouldResemble, Domain{[]interface{}{"age", "<", float64(30)}})
+			So(res[1].Context["group_by"], ShouldResemble, []interface{}{"nums"})
+		})
+		Convey("Filters of the given action should be returned", func() {
+			res := filters.Call("GetFilters", GetFiltersParams{Model: "User", ActionID: "other_action"}).([]*IrFilter)
+			So(res, ShouldHaveLength, 3)
+			So(res[0].Name, ShouldEqual, "Action filter")
+		})
+		Convey("Saving a filter with the same name should replace it", func() {
+			res := filters.Call("CreateOrReplace", FieldMap{
+				"name":     "young USERS",
+				"model_id": "user",
+				"user_id":  float64(1),
+				"domain":   []interface{}{[]interface{}{"age", "<", 25}},
+			}).(*RecordSet)
+			So(res.Ids(), ShouldResemble, private.Ids())
+			So(filters.Filter("ModelID", "=", "User").Filter("UserID", "=", 1).SearchCount(), ShouldEqual, 2)
+		})
+		Convey("Only one filter should be the default", func() {
+			filters.Call("CreateOrReplace", FieldMap{
+				"name":       "Old users",
+				"model_id":   "user",
+				"user_id":    float64(1),
+				"is_default": true,
+			})
+			So(filters.Filter("ModelID", "=", "User").Filter("IsDefault", "=", true).SearchCount(), ShouldEqual, 1)
+			var fMap FieldMap
+			private.ReadValue(&fMap, "IsDefault")
+			So(fMap["is_default"], ShouldBeFalse)
+		})
+		Convey("Wildcards in filter names should be matched literally", func() {
+			discount := filters.Call("CreateOrReplace", FieldMap{
+				"name":       "50% off",
+				"model_id":   "user",
+				"user_id":    float64(1),
+				"is_default": true,
+			}).(*RecordSet)
+			res := filters.Call("CreateOrReplace", FieldMap{
+				"name":       "%_",
+				"model_id":   "user",
+				"user_id":    float64(1),
+				"is_default": true,
+			}).(*RecordSet)
+			So(res.Ids(), ShouldNotResemble, discount.Ids())
+			So(filters.Filter("ModelID", "=", "User").Filter("UserID", "=", 1).SearchCount(), ShouldEqual, 4)
+			var fMap FieldMap
+			discount.ReadValue(&fMap, "IsDefault")
+			So(fMap["is_default"], ShouldBeFalse)
+			res = filters.Call("CreateOrReplace", FieldMap{
+				"name":     "50% OFF",
+				"model_id": "user",
+				"user_id":  float64(1),
+			}).(*RecordSet)
+			So(res.Ids(), ShouldResemble, discount.Ids())
+			So(escapeLikePattern(`50%_off\`), ShouldEqual, `50\%\_off\\`)
+		})
+		Convey("Deleted filters should not be returned", func() {
+			shared.Call("Unlink")
+			res := filters.Call("GetFilters", GetFiltersParams{Model: "user"}).([]*IrFilter)
+			So(res, ShouldHaveLength, 1)
+		})
+		Convey("Filters without name should not be saved", func() {
+			So(func() { filters.Call("CreateOrReplace", FieldMap{"model_id": "user"}) }, ShouldPanic)
+		})
+		env.cr.Rollback()
+	})
+}
@@ -0,0 +1,71 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestExternalIDs(t *testing.T) {
+	Convey("Testing external IDs", t, func() {
+		env := NewEnvironment(1)
+		tag := env.LoadRecord("test.tag_books", "Tag", FieldMap{"Name": "Books"}, false)
+		Convey("Records should be found by their external ID", func() {
+			So(env.HasRef("test.tag_books"), ShouldBeTrue)
+			So(env.Ref("test.tag_books").Ids(), ShouldResemble, tag.Ids())
+			So(env.Ref("test.tag_books").ModelName(), ShouldEqual, "Tag")
+		})
+		Convey("Loading an existing external ID should update its record", func() {
+			res := env.LoadRecord("test.tag_books", "Tag", FieldMap{"Name": "Novels"}, false)
+			So(res.Ids(), ShouldResemble, tag.Ids())
+			var fMap FieldMap
+			tag.ReadValue(&fMap, "Name")
+			So(fMap["name"], ShouldEqual, "Novels")
+			So(env.Pool("IrModelData").Filter("Name", "=", "tag_books").SearchCount(), ShouldEqual, 1)
+		})
+		Convey("Records loaded with noupdate should not be updated", func() {
+			env.LoadRecord("test.tag_music", "Tag", FieldMap{"Name": "Music"}, true)
+			res := env.LoadRecord("test.tag_music", "Tag", FieldMap{"Name": "Songs"}, true)
+			var fMap FieldMap
+			res.ReadValue(&fMap, "Name")
+			So(fMap["name"], ShouldEqual, "Music")
+		})
+		Convey("Deleted records should be created again", func() {
+			tag.Unlink()
+			So(env.HasRef("test.tag_books"), ShouldBeFalse)
+			So(func() { env.Ref("test.tag_books") }, ShouldPanic)
+			res := env.LoadRecord("test.tag_books", "Tag", FieldMap{"Name": "Books"}, false)
+			So(res.Ids(), ShouldNotResemble, tag.Ids())
+			So(env.Ref("test.tag_books").Ids(), ShouldResemble, res.Ids())
+		})
+		Convey("Unknown or malformed external IDs should panic", func() {
+			So(env.HasRef("test.unknown"), ShouldBeFalse)
+			So(func() { env.Ref("test.unknown") }, ShouldPanic)
+			So(func() { env.Ref("tag_books") }, ShouldPanic)
+		})
+		Convey("External IDs should not be reused for another model", func() {
+			So(func() { env.LoadRecord("test.tag_books", "User", FieldMap{"UserName": "Books"}, false) }, ShouldPanic)
+		})
+		Convey("External IDs should be unique in the database", func() {
+			So(testAdapter.indexExists("ir_model_data", "ir_model_data_module_name_unique"), ShouldBeTrue)
+			So(func() {
+				env.Pool("IrModelData").Call("Create", FieldMap{"Module": "test", "Name": "tag_books", "Model": "Tag", "ResID": tag.ID()})
+			}, ShouldPanic)
+		})
+		env.cr.Rollback()
+	})
+}
@@ -0,0 +1,118 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLoad(t *testing.T) {
+	Convey("Testing loading records from rows of strings", t, func() {
+		env := NewEnvironment(1)
+		currencies := env.Pool("Currency").Call("Load", LoadParams{
+			Fields: []string{"id", "Name", "decimal_places"},
+			Data: [][]string{
+				{"currency_load_eur", "Load Euro", "2"},
+				{"", "Load Yen", "0"},
+			},
+			Module: "test",
+		}).(*RecordSet)
+		Convey("Rows should be loaded with converted values", func() {
+			So(currencies.Ids(), ShouldHaveLength, 2)
+			var fMaps []FieldMap
+			currencies.ReadValues(&fMaps, "Name", "DecimalPlaces")
+			So(fMaps[0]["name"], ShouldEqual, "Load Euro")
+			So(fMaps[0]["decimal_places"], ShouldEqual, 2)
+			So(env.Ref("test.currency_load_eur").Ids(), ShouldResemble, currencies.Ids()[:1])
+		})
+		Convey("Loading the same external ID should update the record", func() {
+			res := env.Pool("Currency").Call("Load", LoadParams{
+				Fields: []string{"id", "DecimalPlaces"},
+				Data:   [][]string{{"currency_load_eur", "3"}},
+				Module: "test",
+			}).(*RecordSet)
+			So(res.Ids(), ShouldResemble, currencies.Ids()[:1])
+			var fMap FieldMap
+			res.ReadValue(&fMap, "DecimalPlaces")
+			So(fMap["decimal_places"], ShouldEqual, 3)
+		})
+		Convey("Relational values should be given by external ID, id or name", func() {
+			loadCurrency := func(column, value string) int64 {
+				profile := env.Pool("Profile").Call("Load", LoadParams{
+					Fields: []string{"Age", column},
+					Data:   [][]string{{"30", value}},
+					Module: "test",
+				}).(*RecordSet)
+				var fMap FieldMap
+				profile.ReadValue(&fMap, "Currency")
+				return fMap["currency_id"].(int64)
+			}
+			euroID := currencies.Ids()[0]
+			yenID := currencies.Ids()[1]
+			So(loadCurrency("Currency/id", "currency_load_eur"), ShouldEqual, euroID)
+			So(loadCurrency("currency_id:id", "test.currency_load_eur"), ShouldEqual, euroID)
+			So(loadCurrency("Currency/.id", fmt.Sprintf("%d", yenID)), ShouldEqual, yenID)
+			So(loadCurrency("Currency", "Load Yen"), ShouldEqual, yenID)
+		})
+		Convey("One2many values should link the given records", func() {
+			env.Pool("Post").Call("Load", LoadParams{
+				Fields: []string{"id", "Title"},
+				Data:   [][]string{{"post_load_1", "Loaded post 1"}, {"post_load_2", "Loaded post 2"}},
+				Module: "test",
+			})
+			user := env.Pool("User").Call("Load", LoadParams{
+				Fields: []string{"id", "UserName", "Posts/id"},
+				Data:   [][]string{{"user_load", "Loaded user", "post_load_1, test.post_load_2"}},
+				Module: "test",
+			}).(*RecordSet)
+			So(env.Pool("Post").Filter("User", "=", user.ID()).SearchCount(), ShouldEqual, 2)
+		})
+		Convey("Many2many values should link the given records", func() {
+			env.Pool("Post").Call("Load", LoadParams{
+				Fields: []string{"id", "Title"},
+				Data:   [][]string{{"post_load_1", "Loaded post 1"}, {"post_load_2", "Loaded post 2"}},
+				Module: "test",
+			})
+			loadTag := func(posts string) *RecordSet {
+				return env.Pool("Tag").Call("Load", LoadParams{
+					Fields: []string{"id", "Name", "Posts/id"},
+					Data:   [][]string{{"tag_load", "Loaded tag", posts}},
+					Module: "test",
+				}).(*RecordSet)
+			}
+			tag := loadTag("post_load_1, test.post_load_2, post_load_1")
+			So(env.Pool("Tag").Filter("Posts.Title", "like", "Loaded post").Search().Ids(), ShouldResemble, tag.Ids())
+			So(env.Pool("Tag").Filter("Posts.Title", "=", "Loaded post 2").SearchCount(), ShouldEqual, 1)
+			loadTag("post_load_1")
+			So(env.Pool("Tag").Filter("Posts.Title", "=", "Loaded post 2").SearchCount(), ShouldEqual, 0)
+			So(env.Pool("Tag").Filter("Posts.Title", "=", "Loaded post 1").SearchCount(), ShouldEqual, 1)
+		})
+		Convey("Invalid values should panic", func() {
+			So(func() {
+				env.Pool("Currency").Call("Load", LoadParams{Fields: []string{"DecimalPlaces"}, Data: [][]string{{"two"}}})
+			}, ShouldPanic)
+			So(func() {
+				env.Pool("Currency").Call("Load", LoadParams{Fields: []string{"Name"}, Data: [][]string{{"a", "b"}}})
+			}, ShouldPanic)
+			So(func() {
+				env.Pool("Profile").Call("Load", LoadParams{Fields: []string{"Currency/id"}, Data: [][]string{{"unknown"}}, Module: "test"})
+			}, ShouldPanic)
+		})
+		env.cr.Rollback()
+	})
+}
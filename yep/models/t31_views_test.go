@@ -0,0 +1,104 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"testing"
+
+	"github.com/npiganeau/yep/yep/ir"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestViewsValidation(t *testing.T) {
+	Convey("Testing views validation against models", t, func() {
+		Convey("Valid views should have no errors", func() {
+			view := &ir.View{
+				ID:    "user_form",
+				Model: "User",
+				Type:  ir.VIEW_TYPE_FORM,
+				Arch: `<form>
+	<header><button name="decorate_email" type="object" string="Decorate"/></header>
+	<label for="Email"/><field name="Email"/>
+	<label string="Posts"/>
+	<field name="Posts"><tree><field name="Title"/></tree></field>
+	<field name="status_json"/>
+</form>`,
+			}
+			So(validateView(view), ShouldBeEmpty)
+			search := &ir.View{
+				ID:    "user_search",
+				Model: "User",
+				Type:  ir.VIEW_TYPE_SEARCH,
+				Arch:  `<search><field name="UserName"/><filter name="staff" string="Staff" domain="[('IsStaff', '=', True)]"/></search>`,
+			}
+			So(validateView(search), ShouldBeEmpty)
+		})
+		Convey("All errors of a view should be returned", func() {
+			view := &ir.View{
+				ID:    "user_form",
+				Model: "User",
+				Type:  ir.VIEW_TYPE_FORM,
+				Arch: `<form>
+	<header>
+		<button name="unknown_method" type="object"/>
+		<button name="%(unknown_action)d" type="action"/>
+	</header>
+	<label for="Phone"/><label/>
+	<field name="Nickname"/><field/>
+	<field name="UserName"><tree><field name="Title"/></tree></field>
+	<field name="Posts"><tree><field name="Subtitle"/></tree></field>
+</form>`,
+			}
+			errs := validateView(view)
+			So(errs, ShouldHaveLength, 8)
+			So(errs[0].Error(), ShouldEqual, "unknown method 'unknown_method' of model 'User' in <button>")
+			So(errs[1].Error(), ShouldEqual, "unknown action 'unknown_action' in <button>")
+			So(errs[2].Error(), ShouldEqual, "unknown field 'Phone' of model 'User' in <label for>")
+			So(errs[3].Error(), ShouldEqual, "<label> element without 'for' or 'string' attribute")
+			So(errs[4].Error(), ShouldEqual, "unknown field 'Nickname' of model 'User' in <field>")
+			So(errs[5].Error(), ShouldEqual, "<field> element without 'name' attribute")
+			So(errs[6].Error(), ShouldEqual, "<tree> sub-view in non relational field 'UserName' of model 'User'")
+			So(errs[7].Error(), ShouldEqual, "unknown field 'Subtitle' of model 'Post' in <field>")
+		})
+		Convey("Required attributes should be checked by view type", func() {
+			calendar := &ir.View{
+				ID:    "post_calendar",
+				Model: "Post",
+				Type:  ir.VIEW_TYPE_CALENDAR,
+				Arch:  `<calendar color="Author"><field name="Title"/></calendar>`,
+			}
+			errs := validateView(calendar)
+			So(errs, ShouldHaveLength, 2)
+			So(errs[0].Error(), ShouldEqual, "unknown field 'Author' of model 'Post' in <calendar color>")
+			So(errs[1].Error(), ShouldEqual, "<calendar> element without 'date_start' attribute in calendar view")
+			search := &ir.View{
+				ID:    "user_search",
+				Model: "User",
+				Type:  ir.VIEW_TYPE_SEARCH,
+				Arch:  `<search><filter name="staff"/></search>`,
+			}
+			errs = validateView(search)
+			So(errs, ShouldHaveLength, 1)
+			So(errs[0].Error(), ShouldEqual, "<filter> element without 'string' attribute in search view")
+		})
+		Convey("Views of unknown models should be reported", func() {
+			view := &ir.View{ID: "foo_form", Model: "Foo", Type: ir.VIEW_TYPE_FORM, Arch: `<form/>`}
+			errs := validateView(view)
+			So(errs, ShouldHaveLength, 1)
+			So(errs[0].Error(), ShouldEqual, "unknown model 'Foo'")
+		})
+	})
+}
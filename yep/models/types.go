@@ -17,7 +17,10 @@ package models
 import (
 	"database/sql/driver"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -81,6 +84,109 @@ func (d DateTime) Value() (driver.Value, error) {
 	return driver.Value(time.Time(d).Format("2006-01-02 15:04:05")), nil
 }
 
+// Reference is a polymorphic link to a record of any model.
+// It is stored in database as "ModelName,id".
+type Reference struct {
+	modelName string
+	id        int64
+}
+
+// NewReference returns a Reference to the record with the given id of
+// the given model.
+func NewReference(modelName string, id int64) Reference {
+	return Reference{modelName: modelName, id: id}
+}
+
+// ModelName returns the name of the model of the referenced record
+func (r Reference) ModelName() string {
+	return r.modelName
+}
+
+// ID returns the id of the referenced record
+func (r Reference) ID() int64 {
+	return r.id
+}
+
+// IsNull returns true if the Reference does not point to any record
+func (r Reference) IsNull() bool {
+	return r.modelName == "" || r.id == 0
+}
+
+// String returns the "ModelName,id" representation of the Reference,
+// or an empty string if the Reference is null.
+func (r Reference) String() string {
+	if r.IsNull() {
+		return ""
+	}
+	return fmt.Sprintf("%s,%d", r.modelName, r.id)
+}
+
+// Value formats our Reference for storing in database.
+func (r Reference) Value() (driver.Value, error) {
+	return driver.Value(r.String()), nil
+}
+
+// Scan implements sql.Scanner for Reference. It accepts "ModelName,id"
+// strings and Reference values.
+func (r *Reference) Scan(src interface{}) error {
+	switch val := src.(type) {
+	case nil:
+		*r = Reference{}
+	case Reference:
+		*r = val
+	case string:
+		return r.parse(val)
+	case []byte:
+		return r.parse(string(val))
+	default:
+		return fmt.Errorf("Unable to scan %v (%T) into a Reference", src, src)
+	}
+	return nil
+}
+
+// MarshalJSON for Reference type
+func (r Reference) MarshalJSON() ([]byte, error) {
+	if r.IsNull() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(r.String())
+}
+
+// UnmarshalJSON for Reference type
+func (r *Reference) UnmarshalJSON(data []byte) error {
+	var val interface{}
+	if err := json.Unmarshal(data, &val); err != nil {
+		return err
+	}
+	switch v := val.(type) {
+	case nil, bool:
+		*r = Reference{}
+		return nil
+	case string:
+		return r.parse(v)
+	}
+	return fmt.Errorf("Unable to unmarshal %s into a Reference", data)
+}
+
+// parse sets this Reference from its "ModelName,id" representation.
+// An empty string gives a null Reference.
+func (r *Reference) parse(str string) error {
+	if str == "" {
+		*r = Reference{}
+		return nil
+	}
+	tokens := strings.Split(str, ",")
+	if len(tokens) != 2 {
+		return errors.New("References must have the 'ModelName,id' format")
+	}
+	id, err := strconv.ParseInt(strings.TrimSpace(tokens[1]), 10, 64)
+	if err != nil {
+		return fmt.Errorf("Invalid id in reference '%s': %s", str, err)
+	}
+	*r = Reference{modelName: strings.TrimSpace(tokens[0]), id: id}
+	return nil
+}
+
 // FieldMap is a map of interface{} specifically used for holding model
 // fields values.
 type FieldMap map[string]interface{}
@@ -122,6 +228,39 @@ func (fm *FieldMap) SubstituteKeys(substs []KeySubstitution) {
 	}
 }
 
+// Selection is the ordered list of the allowed values of a selection field.
+// Each item is a [key, label] pair.
+type Selection [][2]string
+
+// Label returns the label of the given key in this Selection and true,
+// or an empty string and false if the key is not in the Selection.
+func (s Selection) Label(key string) (string, bool) {
+	for _, item := range s {
+		if item[0] == key {
+			return item[1], true
+		}
+	}
+	return "", false
+}
+
+// Extend returns a new Selection with the items of s followed by the items
+// of other. Items of other whose keys already exist in s replace their label.
+func (s Selection) Extend(other Selection) Selection {
+	res := make(Selection, len(s))
+	copy(res, s)
+itemsLoop:
+	for _, item := range other {
+		for i, sItem := range res {
+			if sItem[0] == item[0] {
+				res[i][1] = item[1]
+				continue itemsLoop
+			}
+		}
+		res = append(res, item)
+	}
+	return res
+}
+
 // RecordRef is a tuple with an ID and the display name of a record
 type RecordRef struct {
 	ID   int64
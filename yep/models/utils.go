@@ -15,6 +15,7 @@
 package models
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"strings"
@@ -28,6 +29,8 @@ const (
 	defaultStructTagName  = "yep"
 	defaultStructTagDelim = ";"
 	defaultTagDataDelim   = ","
+	selectionLabelDelim   = "|"
+	groupCountKey         = "__count"
 )
 
 var (
@@ -37,6 +40,7 @@ var (
 		"required":       1,
 		"unique":         1,
 		"index":          1,
+		"attachment":     1,
 		"inherits":       1,
 		"nocopy":         1,
 		"string":         2,
@@ -49,6 +53,14 @@ var (
 		"size":           2,
 		"digits":         2,
 		"related":        2,
+		"onchange":       2,
+		"selection":      2,
+		"selection_add":  2,
+		"selection_func": 2,
+		"models":         2,
+		"currency_field": 2,
+		"sizes":          2,
+		"fk":             2,
 	}
 )
 
@@ -142,6 +154,10 @@ func jsonizeExpr(mi *modelInfo, exprs []string) []string {
 	}
 	res = append(res, fi.json)
 	if len(exprs) > 1 {
+		if fi.fieldType == tools.JSON {
+			// Remaining expressions are keys inside the JSON value
+			return append(res, exprs[1:]...)
+		}
 		if fi.relatedModel != nil {
 			res = append(res, jsonizeExpr(fi.relatedModel, exprs[1:])...)
 		} else {
@@ -312,6 +328,8 @@ func getFieldType(typ reflect.Type) tools.FieldType {
 		return tools.FLOAT
 	case k == reflect.String:
 		return tools.CHAR
+	case k == reflect.Map:
+		return tools.JSON
 	case k == reflect.Ptr:
 		indTyp := typ.Elem()
 		switch indTyp.Kind() {
@@ -326,6 +344,10 @@ func getFieldType(typ reflect.Type) tools.FieldType {
 		return tools.DATETIME
 	case reflect.TypeOf(Date{}):
 		return tools.DATE
+	case reflect.TypeOf(Reference{}):
+		return tools.REFERENCE
+	case reflect.TypeOf(Decimal{}):
+		return tools.FLOAT
 	}
 	tools.LogAndPanic(log, "Unable to match field type with go Type. Please specify 'type()' in struct tag", "type", typ)
 	return tools.NO_TYPE
@@ -420,3 +442,89 @@ func convertInterfaceToFieldMap(data interface{}) FieldMap {
 	}
 	return fMap
 }
+
+// jsonTextArg returns the given condition argument converted to the text
+// representation of JSON values, so that it can be compared to a value
+// extracted from a JSON field. Slices are converted element-wise.
+func jsonTextArg(arg interface{}) interface{} {
+	switch val := arg.(type) {
+	case nil:
+		return nil
+	case string:
+		return val
+	}
+	argVal := reflect.ValueOf(arg)
+	if argVal.Kind() == reflect.Slice {
+		res := make([]interface{}, argVal.Len())
+		for i := 0; i < argVal.Len(); i++ {
+			res[i] = jsonTextArg(argVal.Index(i).Interface())
+		}
+		return res
+	}
+	data, err := json.Marshal(arg)
+	if err != nil {
+		tools.LogAndPanic(log, "Unable to marshal JSON condition argument", "arg", arg, "error", err)
+	}
+	return string(data)
+}
+
+// isNumericArg returns true if the given condition argument is a number
+// or a non empty slice of numbers.
+func isNumericArg(arg interface{}) bool {
+	if _, ok := arg.(Decimal); ok {
+		return true
+	}
+	argVal := reflect.ValueOf(arg)
+	switch argVal.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		if argVal.Len() == 0 {
+			return false
+		}
+		for i := 0; i < argVal.Len(); i++ {
+			if !isNumericArg(argVal.Index(i).Interface()) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// convertJSONValue returns a value of the given type from the given JSON
+// field value, which can be either the JSON document as a string or
+// []byte, or any value that marshals to a JSON document compatible with typ.
+func convertJSONValue(typ reflect.Type, value interface{}) (reflect.Value, error) {
+	var data []byte
+	switch val := value.(type) {
+	case []byte:
+		data = val
+	case string:
+		data = []byte(val)
+	default:
+		if reflect.TypeOf(value) == typ {
+			return reflect.ValueOf(value), nil
+		}
+		var err error
+		if data, err = json.Marshal(value); err != nil {
+			return reflect.Value{}, err
+		}
+	}
+	res := reflect.New(typ)
+	if err := json.Unmarshal(data, res.Interface()); err != nil {
+		return reflect.Value{}, err
+	}
+	return res.Elem(), nil
+}
+
+// isNullArg returns true if the given condition argument is nil or a nil pointer
+func isNullArg(arg interface{}) bool {
+	if arg == nil {
+		return true
+	}
+	val := reflect.ValueOf(arg)
+	return val.Kind() == reflect.Ptr && val.IsNil()
+}
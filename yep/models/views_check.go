@@ -0,0 +1,188 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/beevik/etree"
+	"github.com/npiganeau/yep/yep/ir"
+	"github.com/npiganeau/yep/yep/tools"
+)
+
+// viewRequiredAttrs lists by view type the attributes that
+// each tag must have in the arch.
+var viewRequiredAttrs = map[ir.ViewType]map[string][]string{
+	ir.VIEW_TYPE_CALENDAR: {"calendar": {"date_start"}},
+	ir.VIEW_TYPE_GANTT:    {"gantt": {"date_start"}},
+	ir.VIEW_TYPE_SEARCH:   {"filter": {"string"}},
+}
+
+// viewFieldAttrs lists by view type the attributes of the arch root
+// whose values are field names of the model.
+var viewFieldAttrs = map[ir.ViewType][]string{
+	ir.VIEW_TYPE_CALENDAR: {"date_start", "date_stop", "date_delay", "color"},
+	ir.VIEW_TYPE_GANTT:    {"date_start", "date_stop", "date_delay", "progress"},
+	ir.VIEW_TYPE_KANBAN:   {"default_group_by"},
+}
+
+// subViewTypes are the view types that can be embedded in a relational
+// field of another view.
+var subViewTypes = map[ir.ViewType]bool{
+	ir.VIEW_TYPE_TREE:     true,
+	ir.VIEW_TYPE_FORM:     true,
+	ir.VIEW_TYPE_GRAPH:    true,
+	ir.VIEW_TYPE_CALENDAR: true,
+	ir.VIEW_TYPE_GANTT:    true,
+	ir.VIEW_TYPE_KANBAN:   true,
+}
+
+/*
+validateView checks the arch of the given view against the model registry
+and returns all the errors found. It is registered in the ir package to be
+run on all views at bootstrap.
+*/
+func validateView(v *ir.View) []error {
+	if v.Type == ir.VIEW_TYPE_QWEB {
+		return nil
+	}
+	mi, ok := modelRegistry.get(v.Model)
+	if !ok {
+		return []error{fmt.Errorf("unknown model '%s'", v.Model)}
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(v.Arch); err != nil {
+		return []error{fmt.Errorf("unable to parse arch: %s", err)}
+	}
+	vc := viewChecker{}
+	vc.checkView(doc.Root(), mi)
+	return vc.errors
+}
+
+// A viewChecker collects the errors found while walking through a view arch.
+type viewChecker struct {
+	errors []error
+}
+
+// addError adds an error to the list of errors of this viewChecker
+func (vc *viewChecker) addError(format string, args ...interface{}) {
+	vc.errors = append(vc.errors, fmt.Errorf(format, args...))
+}
+
+// checkView checks the given view root element and its children against the given model.
+func (vc *viewChecker) checkView(root *etree.Element, mi *modelInfo) {
+	vType := ir.ViewType(root.Tag)
+	for _, attr := range viewFieldAttrs[vType] {
+		if fieldName := root.SelectAttrValue(attr, ""); fieldName != "" {
+			vc.checkField(fieldName, mi, fmt.Sprintf("<%s %s>", root.Tag, attr))
+		}
+	}
+	vc.checkElement(root, mi, vType)
+}
+
+// checkElement checks the given element of a view of type vType and
+// its children against the given model.
+func (vc *viewChecker) checkElement(elem *etree.Element, mi *modelInfo, vType ir.ViewType) {
+	for _, attr := range viewRequiredAttrs[vType][elem.Tag] {
+		if elem.SelectAttr(attr) == nil {
+			vc.addError("<%s> element without '%s' attribute in %s view", elem.Tag, attr, vType)
+		}
+	}
+	switch elem.Tag {
+	case "field":
+		vc.checkFieldElement(elem, mi, vType)
+		return
+	case "label":
+		vc.checkLabelElement(elem, mi)
+	case "button":
+		vc.checkButtonElement(elem, mi)
+	}
+	for _, child := range elem.ChildElements() {
+		vc.checkElement(child, mi, vType)
+	}
+}
+
+// checkFieldElement checks the given <field> element and its sub-views if any.
+func (vc *viewChecker) checkFieldElement(elem *etree.Element, mi *modelInfo, vType ir.ViewType) {
+	fieldName := elem.SelectAttrValue("name", "")
+	if fieldName == "" {
+		vc.addError("<field> element without 'name' attribute")
+		return
+	}
+	fi := vc.checkField(fieldName, mi, "<field>")
+	for _, child := range elem.ChildElements() {
+		if !subViewTypes[ir.ViewType(child.Tag)] {
+			vc.checkElement(child, mi, vType)
+			continue
+		}
+		if fi == nil {
+			continue
+		}
+		if fi.relatedModel == nil {
+			vc.addError("<%s> sub-view in non relational field '%s' of model '%s'", child.Tag, fieldName, mi.name)
+			continue
+		}
+		vc.checkView(child, fi.relatedModel)
+	}
+}
+
+// checkLabelElement checks that the given <label> element refers to an existing field.
+func (vc *viewChecker) checkLabelElement(elem *etree.Element, mi *modelInfo) {
+	fieldName := elem.SelectAttrValue("for", "")
+	if fieldName == "" {
+		if elem.SelectAttr("string") == nil {
+			vc.addError("<label> element without 'for' or 'string' attribute")
+		}
+		return
+	}
+	vc.checkField(fieldName, mi, "<label for>")
+}
+
+// checkButtonElement checks that the given <button> element refers
+// to an existing method of the model or to an existing action.
+func (vc *viewChecker) checkButtonElement(elem *etree.Element, mi *modelInfo) {
+	name := elem.SelectAttrValue("name", "")
+	switch bType := elem.SelectAttrValue("type", ""); bType {
+	case "object":
+		if name == "" {
+			vc.addError("<button type='object'> element without 'name' attribute")
+			return
+		}
+		if _, ok := mi.methods.get(tools.ConvertMethodName(name)); !ok {
+			vc.addError("unknown method '%s' of model '%s' in <button>", name, mi.name)
+		}
+	case "action":
+		if name == "" {
+			vc.addError("<button type='action'> element without 'name' attribute")
+			return
+		}
+		actionID := strings.TrimSuffix(strings.TrimPrefix(name, "%("), ")d")
+		if ir.ActionsRegistry.GetActionById(actionID) == nil {
+			vc.addError("unknown action '%s' in <button>", actionID)
+		}
+	}
+}
+
+// checkField checks that fieldName is a field of the given model and returns its
+// fieldInfo or nil if it does not exist. elemDesc describes where the field is used.
+func (vc *viewChecker) checkField(fieldName string, mi *modelInfo, elemDesc string) *fieldInfo {
+	fi, ok := mi.fields.get(fieldName)
+	if !ok {
+		vc.addError("unknown field '%s' of model '%s' in %s", fieldName, mi.name, elemDesc)
+		return nil
+	}
+	return fi
+}
@@ -0,0 +1,47 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"html/template"
+	"io/fs"
+
+	"github.com/npiganeau/yep/yep/tools"
+)
+
+/*
+loadHTMLTemplates loads the html templates of the 'templates' directory
+of all modules in the server. Templates are named after their file name.
+*/
+func loadHTMLTemplates() {
+	tmpl := template.New("")
+	var found bool
+	for _, mod := range Modules {
+		files, err := fs.Glob(mod.FS, "templates/*.html")
+		if err != nil {
+			tools.LogAndPanic(log, "Unable to scan templates directory", "module", mod.Name, "error", err)
+		}
+		if len(files) == 0 {
+			continue
+		}
+		if _, err := tmpl.ParseFS(mod.FS, files...); err != nil {
+			tools.LogAndPanic(log, "Unable to parse templates", "module", mod.Name, "error", err)
+		}
+		found = true
+	}
+	if found {
+		yepServer.SetHTMLTemplate(tmpl)
+	}
+}
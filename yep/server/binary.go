@@ -0,0 +1,202 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/tools"
+)
+
+// BINARY_PATH is the root URL path of the routes uploading and downloading
+// the content of attachment fields. It cannot be used as a module name since
+// modules are served on /<module>/static/.
+const BINARY_PATH = "binary"
+
+/*
+mountBinaryRoutes mounts the routes downloading and uploading the content
+of attachment fields on /binary/<model>/<id>/<field>, for the user logged
+in the session.
+*/
+func mountBinaryRoutes() {
+	route := fmt.Sprintf("/%s/:model/:id/:field", BINARY_PATH)
+	yepServer.GET(route, downloadBinaryHandler)
+	yepServer.HEAD(route, downloadBinaryHandler)
+	yepServer.POST(route, uploadBinaryHandler)
+}
+
+/*
+downloadBinaryHandler serves DownloadBinary for the user logged in the
+session. Requests without logged in user are answered with '401 Unauthorized'.
+*/
+func downloadBinaryHandler(c *gin.Context) {
+	uid := SessionUID(c)
+	if uid == 0 {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	DownloadBinary(c, uid)
+}
+
+/*
+uploadBinaryHandler serves UploadBinary for the user logged in the
+session. Requests without logged in user are answered with '401 Unauthorized'.
+*/
+func uploadBinaryHandler(c *gin.Context) {
+	uid := SessionUID(c)
+	if uid == 0 {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	UploadBinary(c, uid)
+}
+
+/*
+collectAttachmentsGarbage removes the files of the filestore that are not
+referenced by any attachment field if the GCAttachments option is set.
+Files more recent than the GCAttachmentsMinAge option are kept.
+*/
+func collectAttachmentsGarbage() {
+	if !tools.Config.GetBool("GCAttachments") {
+		return
+	}
+	models.CollectAttachmentsGarbage(tools.Config.GetDuration("GCAttachmentsMinAge"))
+}
+
+/*
+ReadBinaryField returns a reader on the content of the given attachment
+field of the given model and id, together with the metadata of the content.
+The returned reader is nil if the field has no content. Otherwise the caller
+must close it.
+*/
+func ReadBinaryField(uid, id int64, model, field string) (reader io.ReadCloser, info models.BinaryInfo, rError error) {
+	var rs *models.RecordSet
+	defer func() {
+		if r := recover(); r != nil {
+			if rs != nil {
+				rs.Env().Cr().Rollback()
+			}
+			reader = nil
+			rError = fmt.Errorf("%s", r)
+			return
+		}
+		rs.Env().Cr().Commit()
+	}()
+	if uid == 0 {
+		tools.LogAndPanic(log, "User must be logged in to retrieve binary field")
+	}
+	env := models.NewEnvironment(uid)
+	rs = env.Pool(tools.ConvertModelName(model)).Filter("ID", "=", id)
+	reader, info = rs.ReadBinary(field)
+	return
+}
+
+/*
+WriteBinaryField sets the content of the given attachment field of the
+given model and id to the data read from r.
+*/
+func WriteBinaryField(uid, id int64, model, field string, r io.Reader) (rError error) {
+	var rs *models.RecordSet
+	defer func() {
+		if r := recover(); r != nil {
+			if rs != nil {
+				rs.Env().Cr().Rollback()
+			}
+			rError = fmt.Errorf("%s", r)
+			return
+		}
+		rError = rs.Env().Cr().Commit()
+	}()
+	if uid == 0 {
+		tools.LogAndPanic(log, "User must be logged in to write binary field")
+	}
+	env := models.NewEnvironment(uid)
+	rs = env.Pool(tools.ConvertModelName(model)).Filter("ID", "=", id)
+	rs.WriteBinary(field, r)
+	return
+}
+
+/*
+DownloadBinary streams the content of the attachment field given by the
+"model", "id" and "field" route parameters into the response.
+If the "filename" query parameter is set, the content is sent as a file
+to download with this name.
+*/
+func DownloadBinary(c *gin.Context, uid int64) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	reader, info, err := ReadBinaryField(uid, id, c.Param("model"), c.Param("field"))
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	if reader == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	defer reader.Close()
+	c.Header("Content-Type", info.MimeType)
+	c.Header("ETag", fmt.Sprintf(`"%s"`, info.Checksum))
+	if filename := c.Query("filename"); filename != "" {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	}
+	if seeker, ok := reader.(io.ReadSeeker); ok {
+		// ServeContent handles Range and If-None-Match headers for us
+		http.ServeContent(c.Writer, c.Request, "", time.Time{}, seeker)
+		return
+	}
+	c.Header("Content-Length", strconv.FormatInt(info.Size, 10))
+	c.Status(http.StatusOK)
+	io.Copy(c.Writer, reader)
+}
+
+/*
+UploadBinary sets the content of the attachment field given by the "model",
+"id" and "field" route parameters from the request. The content is taken
+from the "file" part of a multipart form if any, or else from the request
+body.
+*/
+func UploadBinary(c *gin.Context, uid int64) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	var content io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		file, _, err := c.Request.FormFile("file")
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		defer file.Close()
+		content = file
+	}
+	if err := WriteBinaryField(uid, id, c.Param("model"), c.Param("field"), content); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
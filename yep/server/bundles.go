@@ -0,0 +1,268 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/npiganeau/yep/yep/tools"
+)
+
+// Asset types, given by the extension of the asset files
+const (
+	ASSET_JS  = "js"
+	ASSET_CSS = "css"
+	ASSET_XML = "xml"
+)
+
+// assetContentTypes are the content types of the bundles of each asset type
+var assetContentTypes = map[string]string{
+	ASSET_JS:  "application/javascript; charset=utf-8",
+	ASSET_CSS: "text/css; charset=utf-8",
+	ASSET_XML: "text/xml; charset=utf-8",
+}
+
+// ASSETS_PATH is the root URL path of the asset bundles. It cannot be used
+// as a module name since modules are served on /<module>/static/.
+const ASSETS_PATH = "assets"
+
+// cssURLPattern matches the url() values of CSS files
+var cssURLPattern = regexp.MustCompile(`url\(\s*(['"]?)([^'")]*)(['"]?)\s*\)`)
+
+// assetBundlesMaxAge is the cache lifetime in seconds of the bundles, which
+// never change at a given URL since their URL holds the hash of their content.
+const assetBundlesMaxAge = 365 * 24 * 3600
+
+// An assetFile is a file of an asset bundle
+type assetFile struct {
+	mod  *Module
+	path string
+}
+
+// An assetBundle holds the concatenated content of the files of one type
+// of a bundle.
+type assetBundle struct {
+	name        string
+	assetType   string
+	files       []assetFile
+	content     []byte
+	gzipContent []byte
+	hash        string
+}
+
+// fileName returns the file name of this bundle in its URL
+func (b *assetBundle) fileName() string {
+	return fmt.Sprintf("%s.%s.%s", b.name, b.hash, b.assetType)
+}
+
+// assetBundles are the built bundles by bundle name and asset type
+var assetBundles = make(map[string]map[string]*assetBundle)
+
+// assetMinifiers are the functions that minify the bundles by asset type
+var assetMinifiers = make(map[string]func([]byte) ([]byte, error))
+
+/*
+RegisterAssetMinifier registers the given function to minify the bundles
+of the given asset type ("js", "css" or "xml"). Bundles of asset types
+without minifier are served as is.
+*/
+func RegisterAssetMinifier(assetType string, minify func([]byte) ([]byte, error)) {
+	assetMinifiers[assetType] = minify
+}
+
+/*
+AssetBundleURL returns the content-hashed URL of the files of the given asset
+type of the given bundle, or an empty string if the bundle has no such files.
+*/
+func AssetBundleURL(bundle, assetType string) string {
+	b, ok := assetBundles[bundle][assetType]
+	if !ok {
+		return ""
+	}
+	return path.Join("/", ASSETS_PATH, b.fileName())
+}
+
+/*
+AssetFileURLs returns the URLs of the individual files of the given asset type
+of the given bundle, in bundle order. This is meant to load assets one by one
+when debugging.
+*/
+func AssetFileURLs(bundle, assetType string) []string {
+	b, ok := assetBundles[bundle][assetType]
+	if !ok {
+		return nil
+	}
+	res := make([]string, len(b.files))
+	for i, file := range b.files {
+		res[i] = path.Join("/", file.mod.Name, file.path)
+	}
+	return res
+}
+
+/*
+buildAssetBundles builds the asset bundles declared by the modules.
+
+The files of a bundle are concatenated by asset type in the order of the
+modules dependencies, and in the order they are declared in each module.
+*/
+func buildAssetBundles() {
+	for _, mod := range Modules {
+		bundleNames := make([]string, 0, len(mod.Assets))
+		for name := range mod.Assets {
+			bundleNames = append(bundleNames, name)
+		}
+		sort.Strings(bundleNames)
+		for _, name := range bundleNames {
+			for _, file := range moduleFiles(mod, "static", mod.Assets[name]) {
+				assetType := strings.TrimPrefix(path.Ext(file), ".")
+				if _, ok := assetContentTypes[assetType]; !ok {
+					tools.LogAndPanic(log, "Unknown asset type", "module", mod.Name, "bundle", name, "file", file)
+				}
+				if assetBundles[name] == nil {
+					assetBundles[name] = make(map[string]*assetBundle)
+				}
+				b, ok := assetBundles[name][assetType]
+				if !ok {
+					b = &assetBundle{name: name, assetType: assetType}
+					assetBundles[name][assetType] = b
+				}
+				b.files = append(b.files, assetFile{mod: mod, path: file})
+			}
+		}
+	}
+	for _, bundles := range assetBundles {
+		for _, b := range bundles {
+			b.build()
+		}
+	}
+}
+
+/*
+mountAssetBundlesRoute mounts the route serving the asset bundles.
+*/
+func mountAssetBundlesRoute() {
+	yepServer.GET(fmt.Sprintf("/%s/:file", ASSETS_PATH), serveAssetBundle)
+}
+
+/*
+build concatenates and minifies the files of this bundle, and computes
+its hash and gzipped content.
+*/
+func (b *assetBundle) build() {
+	docs := make([][]byte, len(b.files))
+	for i, file := range b.files {
+		content, err := fs.ReadFile(file.mod.FS, file.path)
+		if err != nil {
+			tools.LogAndPanic(log, "Unable to read asset file", "module", file.mod.Name, "bundle", b.name, "file", file.path, "error", err)
+		}
+		if b.assetType == ASSET_CSS {
+			content = rewriteCSSURLs(content, path.Join("/", file.mod.Name, path.Dir(file.path)))
+		}
+		docs[i] = content
+	}
+	switch b.assetType {
+	case ASSET_XML:
+		content, err := tools.ConcatXMLData(docs...)
+		if err != nil {
+			tools.LogAndPanic(log, "Unable to concatenate XML assets", "bundle", b.name, "error", err)
+		}
+		b.content = content
+	case ASSET_JS:
+		// Separate files with ';' in case a file does not end its last statement
+		b.content = bytes.Join(docs, []byte("\n;\n"))
+	default:
+		b.content = bytes.Join(docs, []byte("\n"))
+	}
+	if minify, ok := assetMinifiers[b.assetType]; ok {
+		content, err := minify(b.content)
+		if err != nil {
+			tools.LogAndPanic(log, "Unable to minify asset bundle", "bundle", b.name, "type", b.assetType, "error", err)
+		}
+		b.content = content
+	}
+	b.hash = fmt.Sprintf("%x", sha1.Sum(b.content))[:16]
+
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	gzipWriter.Write(b.content)
+	gzipWriter.Close()
+	b.gzipContent = buf.Bytes()
+}
+
+/*
+rewriteCSSURLs returns the given CSS content with its relative url() values
+made absolute from the given base URL path, so that they still point to
+the module's static files from the URL of the bundle.
+*/
+func rewriteCSSURLs(content []byte, baseURL string) []byte {
+	return cssURLPattern.ReplaceAllFunc(content, func(match []byte) []byte {
+		groups := cssURLPattern.FindSubmatch(match)
+		url := strings.TrimSpace(string(groups[2]))
+		switch {
+		case url == "", strings.HasPrefix(url, "/"), strings.HasPrefix(url, "#"), strings.Contains(url, ":"):
+			// Absolute URLs, fragments and data or external URLs are kept
+			return match
+		}
+		return []byte(fmt.Sprintf("url(%s%s%s)", groups[1], path.Join(baseURL, url), groups[3]))
+	})
+}
+
+/*
+serveAssetBundle serves the bundle given by the file parameter of the
+request, which must be of the form "<bundle>.<hash>.<type>".
+*/
+func serveAssetBundle(c *gin.Context) {
+	file := c.Param("file")
+	typeIndex := strings.LastIndex(file, ".")
+	if typeIndex < 0 {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	hashIndex := strings.LastIndex(file[:typeIndex], ".")
+	if hashIndex < 0 {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	name, hash, assetType := file[:hashIndex], file[hashIndex+1:typeIndex], file[typeIndex+1:]
+	b, ok := assetBundles[name][assetType]
+	if !ok || b.hash != hash {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	etag := fmt.Sprintf(`"%s"`, b.hash)
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", assetBundlesMaxAge))
+	c.Header("Vary", "Accept-Encoding")
+	if c.GetHeader("If-None-Match") == etag {
+		c.AbortWithStatus(http.StatusNotModified)
+		return
+	}
+	content := b.content
+	if acceptsEncoding(c.GetHeader("Accept-Encoding"), "gzip") {
+		c.Header("Content-Encoding", "gzip")
+		content = b.gzipContent
+	}
+	c.Data(http.StatusOK, assetContentTypes[b.assetType], content)
+}
@@ -15,64 +15,92 @@
 package server
 
 import (
-	"fmt"
+	"io/fs"
 	"os"
 	"path"
-	"path/filepath"
 	"runtime"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/beevik/etree"
 	"github.com/npiganeau/yep/yep/ir"
+	"github.com/npiganeau/yep/yep/models"
 	"github.com/npiganeau/yep/yep/tools"
 )
 
-var symlinkDirs = []string{"static", "templates", "data", "views"}
+/*
+Module is the declaration of a YEP module.
+
+The files of the module are read from FS, the virtual filesystem of the
+module directory, which holds its 'static', 'templates', 'data', 'demo'
+and 'views' directories. It is typically an embed.FS. If FS is nil, the
+directory of the source file calling RegisterModule is used.
 
+Data and Demo files are given by their path relative to the module
+directory, such as "data/currencies.csv", and are loaded in the given
+order. If Data or Demo is nil, all the files of the module's 'data' or
+'demo' directory are loaded in alphabetical order.
+
+Assets maps the names of asset bundles, such as "web.assets_backend", to
+the JS, CSS and XML files of the module's 'static' directory that are added
+to each bundle, in order, such as "static/src/js/views.js". A bundle can
+be extended by several modules.
+*/
 type Module struct {
-	Name     string
-	PostInit func()
+	Name    string
+	Version string
+	FS      fs.FS
+	// Depends are the names of the modules this module depends on.
+	Depends []string
+	Data    []string
+	Demo    []string
+	Assets  map[string][]string
+	// Optional modules are skipped instead of failing if one of their
+	// dependencies is not registered. They are installed at the first
+	// start where all their dependencies are registered.
+	Optional bool
+	// Migrations are run when the module is upgraded from an older version.
+	Migrations []Migration
+	PostInit   func()
 }
 
+/*
+Migration updates the database of a module installed with a version
+older than Version.
+*/
+type Migration struct {
+	Version string
+	Migrate func(env *models.Environment)
+}
+
+// Modules are the registered modules, sorted in dependency order
+// once ResolveModules has been called.
 var Modules []*Module
 
 /*
 RegisterModules registers the given module in the server
 This function should be called in the init() function of
-all YEP Addons.
+all YEP Addons. It panics if the module is named "assets" or
+"binary", which are the root URL paths of the asset bundles and
+of the attachment fields routes.
 */
 func RegisterModule(mod *Module) {
-	createModuleSymlinks(mod)
-	Modules = append(Modules, mod)
-}
-
-/*
-createModuleSymlinks create the symlinks of the given module in the
-server directory.
-*/
-func createModuleSymlinks(mod *Module) {
-	_, fileName, _, ok := runtime.Caller(2)
-	if !ok {
-		tools.LogAndPanic(log, "Unable to find caller", "module", mod.Name)
+	switch mod.Name {
+	case ASSETS_PATH:
+		tools.LogAndPanic(log, "Module name is reserved for the asset bundles", "module", mod.Name)
+	case BINARY_PATH:
+		tools.LogAndPanic(log, "Module name is reserved for the attachment fields routes", "module", mod.Name)
 	}
-	for _, dir := range symlinkDirs {
-		srcPath := fmt.Sprintf(path.Dir(fileName)+"/%s", dir)
-		dstPath := fmt.Sprintf("yep/server/%s/%s", dir, mod.Name)
-		if _, err := os.Stat(srcPath); err == nil {
-			os.Symlink(srcPath, dstPath)
+	if mod.FS == nil {
+		_, fileName, _, ok := runtime.Caller(1)
+		if !ok {
+			tools.LogAndPanic(log, "Unable to find caller", "module", mod.Name)
 		}
+		mod.FS = os.DirFS(path.Dir(fileName))
 	}
-}
-
-/*
-cleanModuleSymlinks removes all symlinks in the server symlink directories.
-Note that this function actually removes and recreates the symlink directories.
-*/
-func cleanModuleSymlinks() {
-	for _, dir := range symlinkDirs {
-		dirPath := fmt.Sprintf("yep/server/%s", dir)
-		os.RemoveAll(dirPath)
-		os.Mkdir(dirPath, 0775)
-	}
+	tools.RegisterModuleFS(mod.Name, mod.FS)
+	Modules = append(Modules, mod)
 }
 
 /*
@@ -83,55 +111,40 @@ LoadInternalResources loads all data in the 'views' directory, that are
 */
 func LoadInternalResources() {
 	for _, mod := range Modules {
-		dataDir := fmt.Sprintf("yep/server/views/%s", mod.Name)
-		if _, err := os.Stat(dataDir); err != nil {
-			// No data dir in this module
-			continue
-		}
-		loadData(dataDir)
+		loadData(mod, moduleFiles(mod, "views", nil))
 	}
 }
 
 /*
-loadData loads the data defined in the given data directory.
+loadData loads the data defined in the given files of the given module.
 */
-func loadData(dataDir string) {
-	dataFiles, err := filepath.Glob(dataDir + "/*")
-	if err != nil {
-		tools.LogAndPanic(log, "Unable to scan directory for data files", "dir", dataDir)
-	}
+func loadData(mod *Module, dataFiles []string) {
 	for _, dataFile := range dataFiles {
-		if path.Ext(dataFile) == ".xml" {
-			loadXMLDataFile(dataFile)
-		} else if path.Ext(dataFile) != ".csv" {
-			loadCSVDataFile(dataFile)
+		switch path.Ext(dataFile) {
+		case ".xml":
+			loadXMLDataFile(mod, dataFile)
+		case ".csv":
+			tools.LogAndPanic(log, "CSV data files must be in the data or demo directories", "module", mod.Name, "file", dataFile)
 		}
 	}
 }
 
 /*
-loadXMLDataFile loads the data from an XML data file into memory.
+loadXMLDataFile loads the data from an XML data file of the given module into memory.
 */
-func loadXMLDataFile(fileName string) {
-	doc := etree.NewDocument()
-	if err := doc.ReadFromFile(fileName); err != nil {
-		tools.LogAndPanic(log, "Error loading XML data file", "file", fileName, "error", err)
-	}
-	//var noupdate bool
+func loadXMLDataFile(mod *Module, fileName string) {
+	doc := readXMLFile(mod, fileName)
 	for _, dataTag := range doc.FindElements("yep/data") {
-		//noupdateStr := dataTag.SelectAttrValue("noupdate", "false")
-		//if strings.ToLower(noupdateStr) == "true" {
-		//	noupdate = true
-		//}
 		for _, object := range dataTag.ChildElements() {
 			switch object.Tag {
 			case "view":
-				ir.LoadViewFromEtree(object)
+				ir.LoadViewFromEtree(mod.Name, fileName, object)
 			case "action":
 				ir.LoadActionFromEtree(object)
 			case "menuitem":
 				ir.LoadMenuFromEtree(object)
-			case "record":
+			case "record", "delete", "function":
+				tools.LogAndPanic(log, "Database records must be defined in the data or demo directories", "module", mod.Name, "file", fileName, "tag", object.Tag)
 			default:
 				tools.LogAndPanic(log, "Unknown XML tag", "tag", object.Tag)
 			}
@@ -140,8 +153,238 @@ func loadXMLDataFile(fileName string) {
 }
 
 /*
-loadCSVDataFile loads the data from a CSV data file into memory.
+ResolveModules sorts the registered modules so that each module comes after
+its dependencies. Optional modules with missing dependencies are removed.
+It panics if a module depends on a module that is not registered or if there
+is a dependency cycle.
+
+This function must be called before loading modules resources and data.
+*/
+func ResolveModules() {
+	modules := make(map[string]*Module)
+	for _, mod := range Modules {
+		if _, exists := modules[mod.Name]; exists {
+			tools.LogAndPanic(log, "Module registered twice", "module", mod.Name)
+		}
+		modules[mod.Name] = mod
+	}
+	// Remove optional modules with missing dependencies, which may
+	// be in turn missing dependencies of other optional modules.
+	for removed := true; removed; {
+		removed = false
+		for name, mod := range modules {
+			if !mod.Optional {
+				continue
+			}
+			for _, dep := range mod.Depends {
+				if _, ok := modules[dep]; !ok {
+					log.Info("Skipping optional module with missing dependency", "module", name, "dependency", dep)
+					delete(modules, name)
+					removed = true
+					break
+				}
+			}
+		}
+	}
+
+	const (
+		visiting = iota + 1
+		visited
+	)
+	var sorted []*Module
+	states := make(map[string]int)
+	var visit func(mod *Module, path []string)
+	visit = func(mod *Module, path []string) {
+		path = append(path, mod.Name)
+		switch states[mod.Name] {
+		case visited:
+			return
+		case visiting:
+			tools.LogAndPanic(log, "Dependency cycle between modules", "modules", strings.Join(path, " -> "))
+		}
+		states[mod.Name] = visiting
+		for _, dep := range mod.Depends {
+			depMod, ok := modules[dep]
+			if !ok {
+				tools.LogAndPanic(log, "Module depends on a module that is not registered", "module", mod.Name, "dependency", dep)
+			}
+			visit(depMod, path)
+		}
+		states[mod.Name] = visited
+		sorted = append(sorted, mod)
+	}
+	for _, mod := range Modules {
+		if _, ok := modules[mod.Name]; ok {
+			visit(mod, nil)
+		}
+	}
+	Modules = sorted
+}
+
+/*
+LoadDataRecords loads in the database the records of the data files of the
+modules that are not installed yet or that have been upgraded to a new
+version. The demo files of these modules are also loaded if the Demo
+configuration is set. Upgraded modules have their migrations run first.
+
+Modules are loaded in dependency order, in a single transaction which is
+rolled back if loading fails.
+*/
+func LoadDataRecords() {
+	env := models.NewEnvironment(1)
+	defer func() {
+		if r := recover(); r != nil {
+			env.Cr().Rollback()
+			panic(r)
+		}
+		env.Cr().Commit()
+	}()
+	for _, mod := range Modules {
+		installed := env.Pool("IrModule").Filter("Name", "=", mod.Name).Search()
+		var installedVersion string
+		if len(installed.Ids()) > 0 {
+			var data models.IrModule
+			installed.ReadOne(&data)
+			if data.Version == mod.Version {
+				continue
+			}
+			installedVersion = data.Version
+			runMigrations(env, mod, installedVersion)
+		}
+		log.Info("Loading module data", "module", mod.Name, "version", mod.Version, "installed_version", installedVersion)
+		loadRecordsData(env, mod, moduleFiles(mod, "data", mod.Data))
+		if tools.Config.GetBool("Demo") {
+			loadRecordsData(env, mod, moduleFiles(mod, "demo", mod.Demo))
+		}
+		if len(installed.Ids()) > 0 {
+			installed.Call("Write", models.FieldMap{"Version": mod.Version})
+		} else {
+			env.Pool("IrModule").Call("Create", models.FieldMap{"Name": mod.Name, "Version": mod.Version})
+		}
+	}
+}
+
+/*
+runMigrations runs the migrations of the given module whose version is
+newer than the given installed version and not newer than the module's
+version, in version order.
+*/
+func runMigrations(env *models.Environment, mod *Module, installedVersion string) {
+	migrations := make(migrationsByVersion, len(mod.Migrations))
+	copy(migrations, mod.Migrations)
+	sort.Stable(migrations)
+	for _, migration := range migrations {
+		if compareVersions(migration.Version, installedVersion) <= 0 || compareVersions(migration.Version, mod.Version) > 0 {
+			continue
+		}
+		log.Info("Migrating module", "module", mod.Name, "version", migration.Version)
+		migration.Migrate(env)
+	}
+}
+
+// migrationsByVersion sorts migrations by version order
+type migrationsByVersion []Migration
+
+func (m migrationsByVersion) Len() int {
+	return len(m)
+}
+
+func (m migrationsByVersion) Swap(i, j int) {
+	m[i], m[j] = m[j], m[i]
+}
+
+func (m migrationsByVersion) Less(i, j int) bool {
+	return compareVersions(m[i].Version, m[j].Version) < 0
+}
+
+/*
+compareVersions compares the given dotted versions such as "1.10.2"
+numerically component by component, missing components being 0. It
+returns -1, 0 or 1 if v1 is respectively older than, equal to or newer
+than v2. Non numeric components are compared as strings.
+*/
+func compareVersions(v1, v2 string) int {
+	tokens1 := strings.Split(v1, ".")
+	tokens2 := strings.Split(v2, ".")
+	for i := 0; i < len(tokens1) || i < len(tokens2); i++ {
+		t1, t2 := "0", "0"
+		if i < len(tokens1) {
+			t1 = tokens1[i]
+		}
+		if i < len(tokens2) {
+			t2 = tokens2[i]
+		}
+		n1, err1 := strconv.Atoi(t1)
+		n2, err2 := strconv.Atoi(t2)
+		switch {
+		case err1 == nil && err2 == nil && n1 != n2:
+			if n1 < n2 {
+				return -1
+			}
+			return 1
+		case (err1 != nil || err2 != nil) && t1 != t2:
+			if t1 < t2 {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+/*
+moduleFiles returns the paths in the module filesystem of the given files of
+the given module, which are relative to the module directory and must be in
+the given directory. If files is nil, it returns all the files of the given
+directory of the module in alphabetical order.
 */
-func loadCSVDataFile(fileName string) {
-	// TODO
+func moduleFiles(mod *Module, dir string, files []string) []string {
+	if files == nil {
+		res, err := fs.Glob(mod.FS, dir+"/*")
+		if err != nil {
+			tools.LogAndPanic(log, "Unable to scan directory for data files", "module", mod.Name, "dir", dir)
+		}
+		return res
+	}
+	res := make([]string, len(files))
+	for i, file := range files {
+		file = path.Clean(file)
+		if !strings.HasPrefix(file, dir+"/") {
+			tools.LogAndPanic(log, "Module file is not in the expected directory", "module", mod.Name, "file", file, "dir", dir)
+		}
+		res[i] = file
+	}
+	return res
+}
+
+/*
+readXMLFile reads the given XML file of the given module.
+*/
+func readXMLFile(mod *Module, fileName string) *etree.Document {
+	data, err := fs.ReadFile(mod.FS, fileName)
+	if err != nil {
+		tools.LogAndPanic(log, "Error loading XML data file", "module", mod.Name, "file", fileName, "error", err)
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		tools.LogAndPanic(log, "Error loading XML data file", "module", mod.Name, "file", fileName, "error", err)
+	}
+	return doc
+}
+
+/*
+loadRecordsData loads the records of the given XML and CSV data files
+of the given module.
+*/
+func loadRecordsData(env *models.Environment, mod *Module, dataFiles []string) {
+	for _, dataFile := range dataFiles {
+		switch path.Ext(dataFile) {
+		case ".xml":
+			loadXMLRecordsFile(env, mod, dataFile)
+		case ".csv":
+			loadCSVDataFile(env, mod, dataFile)
+		default:
+			tools.LogAndPanic(log, "Unknown data file type", "module", mod.Name, "file", dataFile)
+		}
+	}
 }
@@ -0,0 +1,275 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/beevik/etree"
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/tools"
+)
+
+// A recordsLoader loads the records defined in the data files of a module.
+type recordsLoader struct {
+	env      *models.Environment
+	module   string
+	noUpdate bool
+}
+
+/*
+loadXMLRecordsFile loads the records of the given XML data file of the
+given module into the database through env.
+*/
+func loadXMLRecordsFile(env *models.Environment, mod *Module, fileName string) {
+	doc := readXMLFile(mod, fileName)
+	for _, dataTag := range doc.FindElements("yep/data") {
+		noUpdate, _ := strconv.ParseBool(dataTag.SelectAttrValue("noupdate", "false"))
+		loader := recordsLoader{
+			env:      env,
+			module:   mod.Name,
+			noUpdate: noUpdate,
+		}
+		for _, object := range dataTag.ChildElements() {
+			switch object.Tag {
+			case "record":
+				loader.loadRecord(object)
+			case "delete":
+				loader.deleteRecords(object)
+			case "function":
+				loader.callFunction(object)
+			case "view", "action", "menuitem":
+				tools.LogAndPanic(log, "Views, actions and menus must be defined in the views directory", "file", fileName, "tag", object.Tag)
+			default:
+				tools.LogAndPanic(log, "Unknown XML tag", "file", fileName, "tag", object.Tag)
+			}
+		}
+	}
+}
+
+/*
+loadCSVDataFile loads the records of the given CSV data file of the given
+module into the database through env.
+
+The file must be named after the model of its records, such as User.csv or
+res.partner.csv. Its first line gives the column names as expected by the
+'Load' method of the model, and the other lines the values of each record.
+*/
+func loadCSVDataFile(env *models.Environment, mod *Module, fileName string) {
+	file, err := mod.FS.Open(fileName)
+	if err != nil {
+		tools.LogAndPanic(log, "Error loading CSV data file", "file", fileName, "error", err)
+	}
+	defer file.Close()
+	lines, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		tools.LogAndPanic(log, "Error reading CSV data file", "file", fileName, "error", err)
+	}
+	if len(lines) == 0 {
+		return
+	}
+	model := tools.ConvertModelName(strings.TrimSuffix(path.Base(fileName), ".csv"))
+	rs := env.Pool(model)
+	for i, line := range lines[1:] {
+		loadCSVLine(rs, mod.Name, fileName, i+2, lines[0], line)
+	}
+}
+
+/*
+loadCSVLine loads the given line of a CSV file with the given header in rs.
+If the line cannot be loaded, the file name and the line number are logged
+and the original panic is raised again.
+*/
+func loadCSVLine(rs *models.RecordSet, module, fileName string, lineNumber int, header, line []string) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error("Error loading CSV data file line", "file", fileName, "line", lineNumber, "error", r)
+			panic(r)
+		}
+	}()
+	rs.Call("Load", models.LoadParams{
+		Fields: header,
+		Data:   [][]string{line},
+		Module: module,
+	})
+}
+
+/*
+xmlID returns the full external ID of the given id, which is prefixed
+with the name of the module if it has no module yet.
+*/
+func (l recordsLoader) xmlID(id string) string {
+	if strings.Contains(id, ".") {
+		return id
+	}
+	return l.module + "." + id
+}
+
+/*
+pyEnv returns the variables available in the eval attributes of data files.
+*/
+func (l recordsLoader) pyEnv() tools.PyEnv {
+	return tools.PyEnv{
+		"uid": l.env.Uid(),
+		"ref": tools.PyFunc(func(args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("ref() takes exactly 1 argument")
+			}
+			xmlID, ok := args[0].(string)
+			if !ok {
+				return nil, fmt.Errorf("ref() argument must be a string, got %T", args[0])
+			}
+			return l.env.Ref(l.xmlID(xmlID)).ID(), nil
+		}),
+	}
+}
+
+/*
+loadRecord creates or updates the record defined by the given <record> element.
+Records with an id are created or updated by their external ID, the others are
+created each time the data file is loaded, that is when the module is
+installed or upgraded.
+*/
+func (l recordsLoader) loadRecord(element *etree.Element) {
+	model := tools.ConvertModelName(element.SelectAttrValue("model", ""))
+	rs := l.env.Pool(model)
+	values := make(models.FieldMap)
+	for _, field := range element.SelectElements("field") {
+		name := field.SelectAttrValue("name", "")
+		if name == "" {
+			tools.LogAndPanic(log, "Record fields must have a name", "model", model)
+		}
+		values[name] = l.fieldValue(rs, name, field)
+	}
+	id := element.SelectAttrValue("id", "")
+	if id == "" {
+		rs.Call("Create", values)
+		return
+	}
+	l.env.LoadRecord(l.xmlID(id), model, values, l.noUpdate)
+}
+
+/*
+fieldValue returns the value of the given <field> element of a record of rs.
+The value is given either by the external ID of its ref attribute, by the
+Python expression of its eval attribute, or by the text of the element.
+*/
+func (l recordsLoader) fieldValue(rs *models.RecordSet, name string, field *etree.Element) interface{} {
+	if ref := field.SelectAttr("ref"); ref != nil {
+		return l.env.Ref(l.xmlID(ref.Value)).ID()
+	}
+	if eval := field.SelectAttr("eval"); eval != nil {
+		value, err := tools.EvalPy(eval.Value, l.pyEnv())
+		if err != nil {
+			tools.LogAndPanic(log, "Unable to evaluate field value", "model", rs.ModelName(), "field", name, "eval", eval.Value, "error", err)
+		}
+		return value
+	}
+	text := field.Text()
+	fInfos := rs.Call("FieldsGet", models.FieldsGetArgs{AllFields: []string{name}}).(map[string]*models.FieldInfo)
+	for _, fInfo := range fInfos {
+		var (
+			value interface{}
+			err   error
+		)
+		switch fInfo.Type {
+		case tools.INTEGER:
+			value, err = strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+		case tools.FLOAT, tools.MONETARY:
+			value, err = strconv.ParseFloat(strings.TrimSpace(text), 64)
+		case tools.BOOLEAN:
+			value, err = strconv.ParseBool(strings.TrimSpace(text))
+		default:
+			value = text
+		}
+		if err != nil {
+			tools.LogAndPanic(log, "Invalid field value", "model", rs.ModelName(), "field", name, "value", text, "error", err)
+		}
+		return value
+	}
+	return text
+}
+
+/*
+deleteRecords deletes the records defined by the given <delete> element,
+either by external ID with the id attribute, or by domain with the search
+attribute. Deleting an external ID that does not exist does nothing.
+It panics if the external ID is bound to a record of another model than
+the model attribute.
+*/
+func (l recordsLoader) deleteRecords(element *etree.Element) {
+	model := tools.ConvertModelName(element.SelectAttrValue("model", ""))
+	id := element.SelectAttrValue("id", "")
+	search := element.SelectAttrValue("search", "")
+	switch {
+	case id != "":
+		if !l.env.HasRef(l.xmlID(id)) {
+			return
+		}
+		rec := l.env.Ref(l.xmlID(id))
+		if rec.ModelName() != model {
+			tools.LogAndPanic(log, "External ID of delete element is bound to a record of another model", "xml_id", l.xmlID(id), "model", model, "bound_model", rec.ModelName())
+		}
+		rec.Call("Unlink")
+	case search != "":
+		rs := l.env.Pool(model)
+		if cond := models.ParseDomain(models.EvalDomain(search, l.pyEnv())); cond != nil {
+			rs = rs.Condition(cond)
+		}
+		rs.Call("Unlink")
+	default:
+		tools.LogAndPanic(log, "Delete elements must have an id or a search attribute", "model", model)
+	}
+}
+
+/*
+callFunction calls the method given by the name attribute of the given
+<function> element on the model of its model attribute. The arguments of
+the method are given as a Python list in the eval attribute. Like records
+without id, functions are called each time the data file is loaded.
+*/
+func (l recordsLoader) callFunction(element *etree.Element) {
+	model := tools.ConvertModelName(element.SelectAttrValue("model", ""))
+	methodName := tools.ConvertMethodName(element.SelectAttrValue("name", ""))
+	args, err := tools.EvalPyList(element.SelectAttrValue("eval", ""), l.pyEnv())
+	if err != nil {
+		tools.LogAndPanic(log, "Unable to evaluate function arguments", "model", model, "method", methodName, "error", err)
+	}
+	rs := l.env.Pool(model)
+	methType := rs.MethodType(methodName)
+	if methType.NumIn()-1 != len(args) {
+		tools.LogAndPanic(log, "Wrong number of function arguments", "model", model, "method", methodName, "args", args, "expected", methType.NumIn()-1)
+	}
+	fnArgs := make([]interface{}, len(args))
+	for i, arg := range args {
+		// Convert the evaluated argument to the type of the method argument
+		data, err := json.Marshal(arg)
+		if err != nil {
+			tools.LogAndPanic(log, "Unable to marshal function argument", "model", model, "method", methodName, "arg", arg, "error", err)
+		}
+		argValue := reflect.New(methType.In(i + 1))
+		if err := json.Unmarshal(data, argValue.Interface()); err != nil {
+			tools.LogAndPanic(log, "Invalid function argument", "model", model, "method", methodName, "arg", arg, "error", err)
+		}
+		fnArgs[i] = argValue.Elem().Interface()
+	}
+	rs.Call(methodName, fnArgs...)
+}
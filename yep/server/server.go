@@ -105,6 +105,18 @@ func BindRPCParams(c *gin.Context, data interface{}) {
 	}
 }
 
+// SESSION_UID is the session key of the id of the logged in user
+const SESSION_UID = "uid"
+
+/*
+SessionUID returns the id of the user logged in the session of the given
+request, or 0 if no user is logged in.
+*/
+func SessionUID(c *gin.Context) int64 {
+	uid, _ := sessions.Default(c).Get(SESSION_UID).(int64)
+	return uid
+}
+
 var yepServer *Server
 var log log15.Logger
 
@@ -124,7 +136,6 @@ func init() {
 	yepServer.Use(gin.Recovery())
 	yepServer.Use(sessions.Sessions("yep-session", store))
 	yepServer.Use(tools.Log15ForGin(log))
-	cleanModuleSymlinks()
 }
 
 /*
@@ -132,13 +143,25 @@ PostInit runs all actions that need to be done after all modules have been loade
 This is typically all actions that need to be done after bootstrapping the models.
 This function:
 - loads the data from the data files of all modules,
-- runs successively all PostInit() func of all modules,
+- removes the unreferenced files of the filestore if GCAttachments is set,
+- serves the static files of each module on /<module>/static/,
+- builds and serves the asset bundles declared by the modules,
+- serves the upload and download routes of attachment fields,
+- runs successively all PostInit() func of all modules in dependency order,
 - loads html templates from all modules.
 */
 func PostInit() {
+	LoadDataRecords()
+	collectAttachmentsGarbage()
+	mountStaticRoutes()
+	buildAssetBundles()
+	mountAssetBundlesRoute()
+	mountBinaryRoutes()
 	for _, module := range Modules {
-		module.PostInit()
+		if module.PostInit != nil {
+			module.PostInit()
+		}
 	}
 
-	yepServer.LoadHTMLGlob("yep/server/templates/**/*.html")
+	loadHTMLTemplates()
 }
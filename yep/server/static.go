@@ -0,0 +1,193 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/npiganeau/yep/yep/tools"
+)
+
+// staticEncodings are the content encodings of the precompressed variants
+// of static files, by order of preference, with the extension of their file.
+var staticEncodings = []struct {
+	encoding  string
+	extension string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// staticETags caches the ETags of the static files by module, path,
+// size and modification time.
+var staticETags = struct {
+	sync.Mutex
+	etags map[string]string
+}{
+	etags: make(map[string]string),
+}
+
+// staticStartTime is the modification time of the static files that have
+// none, such as the files of an embed.FS.
+var staticStartTime = time.Now()
+
+/*
+mountStaticRoutes mounts the 'static' directory of each registered module
+on the /<module>/static/ URL path.
+*/
+func mountStaticRoutes() {
+	for _, mod := range Modules {
+		handler := staticHandler(mod)
+		route := fmt.Sprintf("/%s/static/*filepath", mod.Name)
+		yepServer.GET(route, handler)
+		yepServer.HEAD(route, handler)
+	}
+}
+
+/*
+staticHandler returns the handler serving the static files of the given module.
+
+Precompressed variants of the files, such as 'app.js.br' or 'app.js.gz', are
+served instead of the file if the client accepts their encoding. Responses have
+ETag, Last-Modified and Cache-Control headers, and conditional requests are
+answered with '304 Not Modified' without reading the file once its ETag is
+known. Files without modification time, such as those of an embed.FS, are
+considered modified at server start. Paths with '..' elements are rejected.
+*/
+func staticHandler(mod *Module) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		urlPath := c.Param("filepath")
+		for _, elem := range strings.Split(urlPath, "/") {
+			if elem == ".." {
+				c.AbortWithStatus(http.StatusBadRequest)
+				return
+			}
+		}
+		filePath := path.Join("static", path.Clean("/"+urlPath))
+		info, err := fs.Stat(mod.FS, filePath)
+		if err != nil || info.IsDir() {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		contentType := mime.TypeByExtension(path.Ext(filePath))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		c.Header("Content-Type", contentType)
+		c.Header("Vary", "Accept-Encoding")
+		acceptEncoding := c.GetHeader("Accept-Encoding")
+		for _, variant := range staticEncodings {
+			if !acceptsEncoding(acceptEncoding, variant.encoding) {
+				continue
+			}
+			if variantInfo, err := fs.Stat(mod.FS, filePath+variant.extension); err == nil && !variantInfo.IsDir() {
+				c.Header("Content-Encoding", variant.encoding)
+				filePath += variant.extension
+				info = variantInfo
+				break
+			}
+		}
+
+		file, err := mod.FS.Open(filePath)
+		if err != nil {
+			tools.LogAndPanic(log, "Unable to open static file", "module", mod.Name, "file", filePath, "error", err)
+		}
+		defer file.Close()
+		content, ok := file.(io.ReadSeeker)
+		if !ok {
+			data, err := io.ReadAll(file)
+			if err != nil {
+				tools.LogAndPanic(log, "Unable to read static file", "module", mod.Name, "file", filePath, "error", err)
+			}
+			content = bytes.NewReader(data)
+		}
+		c.Header("ETag", staticETag(mod, filePath, info, content))
+		c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", tools.Config.GetInt("StaticMaxAge")))
+		modTime := info.ModTime()
+		if modTime.IsZero() {
+			modTime = staticStartTime
+		}
+		http.ServeContent(c.Writer, c.Request, filePath, modTime, content)
+	}
+}
+
+/*
+staticETag returns the ETag of the given static file of the given module,
+which is computed from its content. The content is only read the first time,
+and is rewound afterwards.
+*/
+func staticETag(mod *Module, filePath string, info fs.FileInfo, content io.ReadSeeker) string {
+	key := fmt.Sprintf("%s/%s:%d:%d", mod.Name, filePath, info.Size(), info.ModTime().UnixNano())
+	staticETags.Lock()
+	defer staticETags.Unlock()
+	etag, ok := staticETags.etags[key]
+	if ok {
+		return etag
+	}
+	hash := sha1.New()
+	if _, err := io.Copy(hash, content); err != nil {
+		tools.LogAndPanic(log, "Unable to read static file", "module", mod.Name, "file", filePath, "error", err)
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		tools.LogAndPanic(log, "Unable to rewind static file", "module", mod.Name, "file", filePath, "error", err)
+	}
+	etag = fmt.Sprintf(`"%x"`, hash.Sum(nil))
+	staticETags.etags[key] = etag
+	return etag
+}
+
+/*
+acceptsEncoding returns true if the given Accept-Encoding header value
+accepts the given content encoding, either by name or with '*', with a
+non zero quality value.
+*/
+func acceptsEncoding(header, encoding string) bool {
+	accepted := false
+	for _, item := range strings.Split(header, ",") {
+		params := strings.Split(item, ";")
+		name := strings.ToLower(strings.TrimSpace(params[0]))
+		if name != encoding && name != "*" {
+			continue
+		}
+		quality := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil {
+					quality = q
+				}
+			}
+		}
+		if name == encoding {
+			// An explicit value takes precedence over '*'
+			return quality > 0
+		}
+		accepted = quality > 0
+	}
+	return accepted
+}
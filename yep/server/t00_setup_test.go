@@ -0,0 +1,58 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"os"
+
+	_ "github.com/lib/pq"
+	"github.com/npiganeau/yep/yep/models"
+)
+
+// DBARGS are the database connection parameters of the tests that need a
+// database. These tests are skipped if ORM_DRIVER is not set. They share
+// the database of the models tests, so packages must be tested one at a
+// time with 'go test -p 1'.
+var DBARGS = struct {
+	Driver string
+	Source string
+}{
+	os.Getenv("ORM_DRIVER"),
+	os.Getenv("ORM_SOURCE"),
+}
+
+// Book is the model of the data files loaded in the tests
+type Book struct {
+	Name   string
+	Pages  int64
+	Sequel *Book
+	Cover  string `yep:"attachment"`
+}
+
+// setPages sets the number of pages of the books with the given name
+func setPages(rs models.RecordSet, name string, pages int64) {
+	rs.Filter("Name", "=", name).Search().Call("Write", models.FieldMap{"Pages": pages})
+}
+
+func init() {
+	if DBARGS.Driver == "" || DBARGS.Source == "" {
+		return
+	}
+	models.DBConnect(DBARGS.Driver, DBARGS.Source)
+	models.CreateModel("Book")
+	models.ExtendModel("Book", new(Book))
+	models.DeclareMethod("Book", "SetPages", setPages)
+	models.BootStrap()
+}
@@ -0,0 +1,192 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"testing"
+	"testing/fstest"
+
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/tools"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const booksXML = `<yep>
+	<data>
+		<record id="book_go" model="Book">
+			<field name="Name">Go</field>
+			<field name="Pages">300</field>
+		</record>
+		<record model="Book">
+			<field name="Name">Anonymous</field>
+		</record>
+		<record id="book_sequel" model="Book">
+			<field name="Name">Sequel</field>
+			<field name="Sequel" ref="book_go"/>
+			<field name="Pages" eval="2 * 50"/>
+		</record>
+		<function model="Book" name="set_pages" eval="['Anonymous', 42]"/>
+	</data>
+	<data noupdate="1">
+		<record id="book_fixed" model="Book">
+			<field name="Name">Fixed</field>
+		</record>
+	</data>
+</yep>`
+
+const deleteBooksXML = `<yep>
+	<data>
+		<delete model="Book" id="book_go"/>
+		<delete model="Book" search="[('name', '=', 'Anonymous')]"/>
+	</data>
+</yep>`
+
+const deleteWrongModelXML = `<yep>
+	<data>
+		<delete model="IrModule" id="book_go"/>
+	</data>
+</yep>`
+
+func TestXMLRecords(t *testing.T) {
+	Convey("Testing records of XML data files", t, func() {
+		if DBARGS.Driver == "postgres" {
+			env := models.NewEnvironment(1)
+			mod := &Module{
+				Name: "test_records",
+				FS: fstest.MapFS{
+					"data/books.xml":        {Data: []byte(booksXML)},
+					"data/delete.xml":       {Data: []byte(deleteBooksXML)},
+					"data/delete_wrong.xml": {Data: []byte(deleteWrongModelXML)},
+				},
+			}
+			loadXMLRecordsFile(env, mod, "data/books.xml")
+			books := env.Pool("Book")
+			Convey("Records with an id should be bound to their external ID", func() {
+				So(env.Ref("test_records.book_go").ModelName(), ShouldEqual, "Book")
+				So(books.Filter("Name", "=", "Go").Filter("Pages", "=", 300).Search().Ids(), ShouldResemble, env.Ref("test_records.book_go").Ids())
+			})
+			Convey("Records without id should be created", func() {
+				So(books.Filter("Name", "=", "Anonymous").SearchCount(), ShouldEqual, 1)
+			})
+			Convey("Field values should be given by ref and eval attributes", func() {
+				goID := env.Ref("test_records.book_go").ID()
+				So(books.Filter("Sequel", "=", goID).Filter("Pages", "=", 100).Search().Ids(), ShouldResemble, env.Ref("test_records.book_sequel").Ids())
+			})
+			Convey("Functions should be called with their arguments", func() {
+				So(books.Filter("Name", "=", "Anonymous").Filter("Pages", "=", 42).SearchCount(), ShouldEqual, 1)
+			})
+			Convey("Reloading should only update records without noupdate", func() {
+				env.Ref("test_records.book_go").Call("Write", models.FieldMap{"Name": "Changed Go"})
+				env.Ref("test_records.book_fixed").Call("Write", models.FieldMap{"Name": "Changed Fixed"})
+				loadXMLRecordsFile(env, mod, "data/books.xml")
+				So(books.Filter("Name", "=", "Go").SearchCount(), ShouldEqual, 1)
+				So(books.Filter("Name", "=", "Changed Fixed").SearchCount(), ShouldEqual, 1)
+				So(books.Filter("Name", "=", "Anonymous").SearchCount(), ShouldEqual, 2)
+			})
+			Convey("Delete elements should delete by external ID and by search", func() {
+				loadXMLRecordsFile(env, mod, "data/delete.xml")
+				So(env.HasRef("test_records.book_go"), ShouldBeFalse)
+				So(books.Filter("Name", "=", "Anonymous").SearchCount(), ShouldEqual, 0)
+				So(func() { loadXMLRecordsFile(env, mod, "data/delete.xml") }, ShouldNotPanic)
+			})
+			Convey("Deleting an external ID of another model should panic", func() {
+				So(func() { loadXMLRecordsFile(env, mod, "data/delete_wrong.xml") }, ShouldPanic)
+				So(env.HasRef("test_records.book_go"), ShouldBeTrue)
+			})
+			env.Cr().Rollback()
+		}
+	})
+}
+
+func TestCSVRecords(t *testing.T) {
+	Convey("Testing records of CSV data files", t, func() {
+		if DBARGS.Driver == "postgres" {
+			env := models.NewEnvironment(1)
+			mod := &Module{
+				Name: "test_records",
+				FS: fstest.MapFS{
+					"data/Book.csv":     {Data: []byte("id,Name,Pages\nbook_csv,CSV,12\n")},
+					"data/bad/Book.csv": {Data: []byte("Name,Pages\nGood,1\nBad,twelve\n")},
+				},
+			}
+			Convey("CSV lines should be loaded with their external ID", func() {
+				loadCSVDataFile(env, mod, "data/Book.csv")
+				So(env.Pool("Book").Filter("Name", "=", "CSV").Filter("Pages", "=", 12).Search().Ids(), ShouldResemble, env.Ref("test_records.book_csv").Ids())
+			})
+			Convey("Errors of CSV lines should be raised unchanged", func() {
+				var err interface{}
+				func() {
+					defer func() { err = recover() }()
+					loadCSVDataFile(env, mod, "data/bad/Book.csv")
+				}()
+				So(err, ShouldNotBeNil)
+				So(fmt.Sprint(err), ShouldContainSubstring, "Invalid field value")
+			})
+			env.Cr().Rollback()
+		}
+	})
+}
+
+func TestLoadDataRecords(t *testing.T) {
+	Convey("Testing the loading of module data on install and upgrade", t, func() {
+		if DBARGS.Driver == "postgres" {
+			registered := Modules
+			mod := &Module{
+				Name:    "test_install",
+				Version: "1.0",
+				FS: fstest.MapFS{
+					"data/books.xml": {Data: []byte(`<yep><data>
+						<record model="Book"><field name="Name">Installed</field></record>
+						<function model="Book" name="set_pages" eval="['Installed', 7]"/>
+					</data></yep>`)},
+					"demo/books.xml": {Data: []byte(`<yep><data>
+						<record id="book_demo" model="Book"><field name="Name">Demo</field></record>
+					</data></yep>`)},
+				},
+			}
+			Modules = []*Module{mod}
+			countBooks := func(name string) int {
+				env := models.NewEnvironment(1)
+				defer env.Cr().Rollback()
+				return env.Pool("Book").Filter("Name", "=", name).SearchCount()
+			}
+			tools.Config.Set("Demo", false)
+			LoadDataRecords()
+			Convey("Data should be loaded on install, without demo data", func() {
+				So(countBooks("Installed"), ShouldEqual, 1)
+				So(countBooks("Demo"), ShouldEqual, 0)
+			})
+			Convey("Data should not be loaded again if the module is not upgraded", func() {
+				LoadDataRecords()
+				So(countBooks("Installed"), ShouldEqual, 1)
+			})
+			Convey("Data should be loaded again on upgrade, with demo data if set", func() {
+				mod.Version = "1.1"
+				tools.Config.Set("Demo", true)
+				LoadDataRecords()
+				So(countBooks("Installed"), ShouldEqual, 2)
+				So(countBooks("Demo"), ShouldEqual, 1)
+			})
+			env := models.NewEnvironment(1)
+			env.Pool("Book").Filter("Name", "in", []string{"Installed", "Demo"}).Call("Unlink")
+			env.Pool("IrModelData").Filter("Module", "=", mod.Name).Call("Unlink")
+			env.Pool("IrModule").Filter("Name", "=", mod.Name).Call("Unlink")
+			env.Cr().Commit()
+			tools.Config.Set("Demo", false)
+			Modules = registered
+		}
+	})
+}
@@ -0,0 +1,125 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/npiganeau/yep/yep/models"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// resolvedModules resolves the given modules and returns their names in
+// resolution order. The registered modules are restored afterwards.
+func resolvedModules(mods ...*Module) []string {
+	registered := Modules
+	defer func() { Modules = registered }()
+	Modules = mods
+	ResolveModules()
+	res := make([]string, len(Modules))
+	for i, mod := range Modules {
+		res[i] = mod.Name
+	}
+	return res
+}
+
+func TestResolveModules(t *testing.T) {
+	Convey("Testing the resolution of module dependencies", t, func() {
+		Convey("Modules should come after their dependencies", func() {
+			So(resolvedModules(
+				&Module{Name: "sale", Depends: []string{"product", "base"}},
+				&Module{Name: "product", Depends: []string{"base"}},
+				&Module{Name: "base"},
+			), ShouldResemble, []string{"base", "product", "sale"})
+		})
+		Convey("Independent modules should keep their registration order", func() {
+			So(resolvedModules(
+				&Module{Name: "b"},
+				&Module{Name: "a"},
+				&Module{Name: "c", Depends: []string{"a"}},
+			), ShouldResemble, []string{"b", "a", "c"})
+		})
+		Convey("Optional modules should be skipped if a dependency is missing", func() {
+			So(resolvedModules(
+				&Module{Name: "base"},
+				&Module{Name: "bridge", Depends: []string{"base", "missing"}, Optional: true},
+				&Module{Name: "bridge_ext", Depends: []string{"bridge"}, Optional: true},
+				&Module{Name: "extra", Depends: []string{"base"}, Optional: true},
+			), ShouldResemble, []string{"base", "extra"})
+		})
+		Convey("Missing dependencies of other modules should panic", func() {
+			So(func() { resolvedModules(&Module{Name: "sale", Depends: []string{"product"}}) }, ShouldPanic)
+			So(func() {
+				resolvedModules(
+					&Module{Name: "bridge", Depends: []string{"missing"}, Optional: true},
+					&Module{Name: "sale", Depends: []string{"bridge"}},
+				)
+			}, ShouldPanic)
+		})
+		Convey("Dependency cycles should panic", func() {
+			So(func() {
+				resolvedModules(
+					&Module{Name: "a", Depends: []string{"b"}},
+					&Module{Name: "b", Depends: []string{"c"}},
+					&Module{Name: "c", Depends: []string{"a"}},
+				)
+			}, ShouldPanic)
+			So(func() { resolvedModules(&Module{Name: "a", Depends: []string{"a"}}) }, ShouldPanic)
+		})
+		Convey("Modules registered twice should panic", func() {
+			So(func() { resolvedModules(&Module{Name: "base"}, &Module{Name: "base"}) }, ShouldPanic)
+		})
+	})
+}
+
+func TestCompareVersions(t *testing.T) {
+	Convey("Testing the comparison of module versions", t, func() {
+		cases := []struct {
+			v1, v2 string
+			res    int
+		}{
+			{"1.0", "1.0", 0},
+			{"1.0", "1", 0},
+			{"1.2", "1.10", -1},
+			{"1.10.2", "1.10", 1},
+			{"2.0", "10.0", -1},
+			{"1.0.1", "1.0.0", 1},
+			{"1.0a", "1.0b", -1},
+			{"1.b", "1.a", 1},
+			{"", "1.0", -1},
+		}
+		for _, c := range cases {
+			So(compareVersions(c.v1, c.v2), ShouldEqual, c.res)
+			So(compareVersions(c.v2, c.v1), ShouldEqual, -c.res)
+		}
+	})
+}
+
+func TestRunMigrations(t *testing.T) {
+	Convey("Testing the migrations of upgraded modules", t, func() {
+		var run []string
+		migration := func(version string) Migration {
+			return Migration{Version: version, Migrate: func(env *models.Environment) { run = append(run, version) }}
+		}
+		mod := &Module{
+			Name:       "test_migrations",
+			Version:    "1.10",
+			Migrations: []Migration{migration("1.10"), migration("1.2"), migration("1.0"), migration("2.0"), migration("1.9")},
+		}
+		runMigrations(nil, mod, "1.1")
+		So(run, ShouldResemble, []string{"1.2", "1.9", "1.10"})
+	})
+}
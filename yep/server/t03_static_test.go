@@ -0,0 +1,141 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// readCountingFS is a filesystem counting the reads of its files
+type readCountingFS struct {
+	fs.FS
+	reads int
+}
+
+func (r *readCountingFS) Open(name string) (fs.File, error) {
+	file, err := r.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &readCountingFile{File: file, fsys: r}, nil
+}
+
+// readCountingFile is a file of a readCountingFS
+type readCountingFile struct {
+	fs.File
+	fsys *readCountingFS
+}
+
+func (r *readCountingFile) Read(p []byte) (int, error) {
+	r.fsys.reads++
+	return r.File.Read(p)
+}
+
+func (r *readCountingFile) Seek(offset int64, whence int) (int64, error) {
+	return r.File.(interface {
+		Seek(int64, int) (int64, error)
+	}).Seek(offset, whence)
+}
+
+func TestStaticFiles(t *testing.T) {
+	Convey("Testing the static files handler", t, func() {
+		modTime := time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC)
+		fsys := &readCountingFS{FS: fstest.MapFS{
+			"static/src/js/app.js":    {Data: []byte("var app;"), ModTime: modTime},
+			"static/src/js/app.js.gz": {Data: []byte("gzipped"), ModTime: modTime},
+			"static/src/js/app.js.br": {Data: []byte("brotli"), ModTime: modTime},
+			"static/src/css/app.css":  {Data: []byte("body {}")},
+			"views/secret.xml":        {Data: []byte("<yep/>")},
+		}}
+		mod := &Module{Name: "test_static", FS: fsys}
+		router := gin.New()
+		router.GET("/test_static/static/*filepath", staticHandler(mod))
+		get := func(url string, headers map[string]string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, url, nil)
+			for key, value := range headers {
+				req.Header.Set(key, value)
+			}
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+			return resp
+		}
+		Convey("Files should be served with cache headers", func() {
+			resp := get("/test_static/static/src/js/app.js", nil)
+			So(resp.Code, ShouldEqual, http.StatusOK)
+			So(resp.Body.String(), ShouldEqual, "var app;")
+			So(resp.Header().Get("ETag"), ShouldNotBeEmpty)
+			So(resp.Header().Get("Last-Modified"), ShouldEqual, modTime.Format(http.TimeFormat))
+			So(resp.Header().Get("Cache-Control"), ShouldStartWith, "public")
+			So(resp.Header().Get("Content-Encoding"), ShouldBeEmpty)
+		})
+		Convey("Files without modification time should have a Last-Modified header", func() {
+			resp := get("/test_static/static/src/css/app.css", nil)
+			So(resp.Code, ShouldEqual, http.StatusOK)
+			So(resp.Header().Get("Last-Modified"), ShouldEqual, staticStartTime.UTC().Format(http.TimeFormat))
+		})
+		Convey("Conditional requests should not read the file", func() {
+			etag := get("/test_static/static/src/js/app.js", nil).Header().Get("ETag")
+			reads := fsys.reads
+			resp := get("/test_static/static/src/js/app.js", map[string]string{"If-None-Match": etag})
+			So(resp.Code, ShouldEqual, http.StatusNotModified)
+			So(fsys.reads, ShouldEqual, reads)
+			resp = get("/test_static/static/src/js/app.js", map[string]string{"If-Modified-Since": modTime.Format(http.TimeFormat)})
+			So(resp.Code, ShouldEqual, http.StatusNotModified)
+		})
+		Convey("Precompressed variants should be served if accepted", func() {
+			resp := get("/test_static/static/src/js/app.js", map[string]string{"Accept-Encoding": "gzip, deflate, br"})
+			So(resp.Header().Get("Content-Encoding"), ShouldEqual, "br")
+			So(resp.Body.String(), ShouldEqual, "brotli")
+			So(resp.Header().Get("Content-Type"), ShouldEqual, mime.TypeByExtension(".js"))
+			resp = get("/test_static/static/src/js/app.js", map[string]string{"Accept-Encoding": "br;q=0, gzip;q=0.8"})
+			So(resp.Header().Get("Content-Encoding"), ShouldEqual, "gzip")
+			So(resp.Body.String(), ShouldEqual, "gzipped")
+			resp = get("/test_static/static/src/js/app.js", map[string]string{"Accept-Encoding": "gzip;q=0, br;q=0.0"})
+			So(resp.Header().Get("Content-Encoding"), ShouldBeEmpty)
+			So(resp.Body.String(), ShouldEqual, "var app;")
+			resp = get("/test_static/static/src/js/app.js", map[string]string{"Accept-Encoding": "*;q=0.5, br;q=0"})
+			So(resp.Header().Get("Content-Encoding"), ShouldEqual, "gzip")
+		})
+		Convey("Paths outside of the static directory should be rejected", func() {
+			So(get("/test_static/static/../views/secret.xml", nil).Code, ShouldEqual, http.StatusBadRequest)
+			So(get("/test_static/static/src/../../views/secret.xml", nil).Code, ShouldEqual, http.StatusBadRequest)
+			So(get("/test_static/static/src", nil).Code, ShouldEqual, http.StatusNotFound)
+			So(get("/test_static/static/missing.js", nil).Code, ShouldEqual, http.StatusNotFound)
+		})
+	})
+}
+
+func TestAcceptsEncoding(t *testing.T) {
+	Convey("Testing the parsing of Accept-Encoding headers", t, func() {
+		So(acceptsEncoding("gzip, br", "gzip"), ShouldBeTrue)
+		So(acceptsEncoding("GZIP", "gzip"), ShouldBeTrue)
+		So(acceptsEncoding("gzip;q=0", "gzip"), ShouldBeFalse)
+		So(acceptsEncoding("gzip; q=0.001", "gzip"), ShouldBeTrue)
+		So(acceptsEncoding("x-gzip", "gzip"), ShouldBeFalse)
+		So(acceptsEncoding("*", "br"), ShouldBeTrue)
+		So(acceptsEncoding("*;q=0, gzip", "br"), ShouldBeFalse)
+		So(acceptsEncoding("*, br;q=0", "br"), ShouldBeFalse)
+		So(acceptsEncoding("", "gzip"), ShouldBeFalse)
+	})
+}
@@ -0,0 +1,120 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAssetBundles(t *testing.T) {
+	Convey("Testing asset bundles", t, func() {
+		registered := Modules
+		assetBundles = make(map[string]map[string]*assetBundle)
+		Modules = []*Module{
+			{
+				Name: "test_base",
+				FS: fstest.MapFS{
+					"static/src/js/b.js":       {Data: []byte("var b;")},
+					"static/src/js/a.js":       {Data: []byte("var a;")},
+					"static/src/css/base.css":  {Data: []byte(`.logo { background: url("../img/logo.png"); }`)},
+					"static/src/xml/base.xml":  {Data: []byte(`<templates><t t-name="base"/></templates>`)},
+					"static/src/css/other.css": {Data: []byte(`.a { background: url(data:image/png;base64,AAA=) url(/web/static/x.png) url( 'img/y.png' ); }`)},
+				},
+				Assets: map[string][]string{
+					"test.assets": {"static/src/js/b.js", "static/src/js/a.js", "static/src/css/base.css", "static/src/xml/base.xml"},
+					"test.other":  {"static/src/css/other.css"},
+				},
+			},
+			{
+				Name: "test_ext",
+				FS: fstest.MapFS{
+					"static/js/ext.js":   {Data: []byte("var ext;")},
+					"static/xml/ext.xml": {Data: []byte(`<templates><t t-name="ext"/></templates>`)},
+				},
+				Depends: []string{"test_base"},
+				Assets: map[string][]string{
+					"test.assets": {"static/js/ext.js", "static/xml/ext.xml"},
+				},
+			},
+		}
+		buildAssetBundles()
+		router := gin.New()
+		router.GET("/assets/:file", serveAssetBundle)
+		get := func(url string, headers map[string]string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, url, nil)
+			for key, value := range headers {
+				req.Header.Set(key, value)
+			}
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+			return resp
+		}
+		Convey("Files should be bundled in module and declaration order", func() {
+			So(string(assetBundles["test.assets"][ASSET_JS].content), ShouldEqual, "var b;\n;\nvar a;\n;\nvar ext;")
+			So(string(assetBundles["test.assets"][ASSET_XML].content), ShouldEqual, `<templates><t t-name="base"/><t t-name="ext"/></templates>`)
+			So(AssetFileURLs("test.assets", ASSET_JS), ShouldResemble, []string{
+				"/test_base/static/src/js/b.js",
+				"/test_base/static/src/js/a.js",
+				"/test_ext/static/js/ext.js",
+			})
+		})
+		Convey("Relative CSS URLs should point to the module static files", func() {
+			So(string(assetBundles["test.assets"][ASSET_CSS].content), ShouldEqual, `.logo { background: url("/test_base/static/src/img/logo.png"); }`)
+			So(string(assetBundles["test.other"][ASSET_CSS].content), ShouldEqual,
+				`.a { background: url(data:image/png;base64,AAA=) url(/web/static/x.png) url('/test_base/static/src/css/img/y.png'); }`)
+		})
+		Convey("Bundles should be served at their content-hashed URL", func() {
+			url := AssetBundleURL("test.assets", ASSET_JS)
+			So(url, ShouldStartWith, "/assets/test.assets.")
+			So(url, ShouldEndWith, ".js")
+			So(AssetBundleURL("test.assets", "png"), ShouldEqual, "")
+			resp := get(url, nil)
+			So(resp.Code, ShouldEqual, http.StatusOK)
+			So(resp.Body.String(), ShouldEqual, "var b;\n;\nvar a;\n;\nvar ext;")
+			So(resp.Header().Get("Cache-Control"), ShouldContainSubstring, "immutable")
+			So(get(strings.Replace(url, assetBundles["test.assets"][ASSET_JS].hash, "0123456789abcdef", 1), nil).Code, ShouldEqual, http.StatusNotFound)
+			So(get("/assets/unknown", nil).Code, ShouldEqual, http.StatusNotFound)
+			resp = get(url, map[string]string{"If-None-Match": resp.Header().Get("ETag")})
+			So(resp.Code, ShouldEqual, http.StatusNotModified)
+		})
+		Convey("Bundles should be gzipped if accepted", func() {
+			url := AssetBundleURL("test.assets", ASSET_CSS)
+			resp := get(url, map[string]string{"Accept-Encoding": "gzip, br"})
+			So(resp.Header().Get("Content-Encoding"), ShouldEqual, "gzip")
+			reader, err := gzip.NewReader(bytes.NewReader(resp.Body.Bytes()))
+			So(err, ShouldBeNil)
+			content, _ := io.ReadAll(reader)
+			So(string(content), ShouldEqual, string(assetBundles["test.assets"][ASSET_CSS].content))
+			resp = get(url, map[string]string{"Accept-Encoding": "gzip;q=0"})
+			So(resp.Header().Get("Content-Encoding"), ShouldBeEmpty)
+		})
+		Convey("The assets and binary module names should be reserved", func() {
+			So(func() { RegisterModule(&Module{Name: ASSETS_PATH}) }, ShouldPanic)
+			So(func() { RegisterModule(&Module{Name: BINARY_PATH}) }, ShouldPanic)
+		})
+		Modules = registered
+		assetBundles = make(map[string]map[string]*assetBundle)
+	})
+}
@@ -0,0 +1,170 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/npiganeau/yep/yep/models"
+	"github.com/npiganeau/yep/yep/tools"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBinaryRoutes(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "yep-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+	tools.Config.Set("DataDir", dataDir)
+
+	Convey("Testing the attachment fields routes", t, func() {
+		router := gin.New()
+		router.Use(sessions.Sessions("yep-session", sessions.NewCookieStore([]byte("secret"))))
+		router.GET("/login", func(c *gin.Context) {
+			session := sessions.Default(c)
+			session.Set(SESSION_UID, int64(1))
+			session.Save()
+		})
+		route := fmt.Sprintf("/%s/:model/:id/:field", BINARY_PATH)
+		router.GET(route, downloadBinaryHandler)
+		router.POST(route, uploadBinaryHandler)
+		var cookie string
+		serve := func(method, url, contentType string, body []byte, headers map[string]string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, url, bytes.NewReader(body))
+			if contentType != "" {
+				req.Header.Set("Content-Type", contentType)
+			}
+			if cookie != "" {
+				req.Header.Set("Cookie", cookie)
+			}
+			for key, value := range headers {
+				req.Header.Set(key, value)
+			}
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+			return resp
+		}
+		Convey("Requests without logged in user should be rejected", func() {
+			So(serve(http.MethodGet, "/binary/Book/1/cover", "", nil, nil).Code, ShouldEqual, http.StatusUnauthorized)
+			So(serve(http.MethodPost, "/binary/Book/1/cover", "text/plain", []byte("Cover"), nil).Code, ShouldEqual, http.StatusUnauthorized)
+		})
+		cookie = strings.Split(serve(http.MethodGet, "/login", "", nil, nil).Header().Get("Set-Cookie"), ";")[0]
+		Convey("Invalid ids should be rejected", func() {
+			So(serve(http.MethodGet, "/binary/Book/abc/cover", "", nil, nil).Code, ShouldEqual, http.StatusBadRequest)
+			So(serve(http.MethodPost, "/binary/Book/abc/cover", "text/plain", []byte("Cover"), nil).Code, ShouldEqual, http.StatusBadRequest)
+		})
+		if DBARGS.Driver == "postgres" {
+			env := models.NewEnvironment(1)
+			book := env.Pool("Book").Create(models.FieldMap{"Name": "Binary"})
+			env.Cr().Commit()
+			url := fmt.Sprintf("/binary/Book/%d/cover", book.ID())
+			Convey("Fields without content should not be found", func() {
+				So(serve(http.MethodGet, url, "", nil, nil).Code, ShouldEqual, http.StatusNotFound)
+			})
+			Convey("Uploaded content should be downloaded", func() {
+				So(serve(http.MethodPost, url, "text/plain", []byte("Go cover"), nil).Code, ShouldEqual, http.StatusNoContent)
+				resp := serve(http.MethodGet, url+"?filename=cover.txt", "", nil, nil)
+				So(resp.Code, ShouldEqual, http.StatusOK)
+				So(resp.Body.String(), ShouldEqual, "Go cover")
+				So(resp.Header().Get("Content-Type"), ShouldStartWith, "text/plain")
+				So(resp.Header().Get("Content-Disposition"), ShouldEqual, `attachment; filename="cover.txt"`)
+				etag := resp.Header().Get("ETag")
+				So(etag, ShouldNotBeEmpty)
+				So(serve(http.MethodGet, url, "", nil, map[string]string{"If-None-Match": etag}).Code, ShouldEqual, http.StatusNotModified)
+			})
+			Convey("Content should be uploaded from multipart forms", func() {
+				var body bytes.Buffer
+				writer := multipart.NewWriter(&body)
+				part, _ := writer.CreateFormFile("file", "cover.txt")
+				part.Write([]byte("Multipart cover"))
+				writer.Close()
+				So(serve(http.MethodPost, url, writer.FormDataContentType(), body.Bytes(), nil).Code, ShouldEqual, http.StatusNoContent)
+				So(serve(http.MethodGet, url, "", nil, nil).Body.String(), ShouldEqual, "Multipart cover")
+			})
+			Reset(func() {
+				env := models.NewEnvironment(1)
+				env.Pool("Book").Filter("Name", "=", "Binary").Unlink()
+				env.Cr().Commit()
+			})
+		}
+	})
+}
+
+func TestCollectAttachmentsGarbage(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "yep-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+	tools.Config.Set("DataDir", dataDir)
+
+	Convey("Testing the garbage collection of attachments at startup", t, func() {
+		stored := func(checksum string) bool {
+			file, err := tools.OpenStoredFile(checksum)
+			if err != nil {
+				return false
+			}
+			file.Close()
+			return true
+		}
+		unused, _ := tools.StoreFile(strings.NewReader("Unused cover"))
+		Convey("Files should be kept if GCAttachments is not set", func() {
+			tools.Config.Set("GCAttachments", false)
+			collectAttachmentsGarbage()
+			So(stored(unused), ShouldBeTrue)
+		})
+		if DBARGS.Driver == "postgres" {
+			env := models.NewEnvironment(1)
+			book := env.Pool("Book").Create(models.FieldMap{"Name": "Garbage"})
+			book.WriteBinary("Cover", strings.NewReader("Used cover"))
+			used := book.BinaryInfo("Cover").Checksum
+			env.Cr().Commit()
+			tools.Config.Set("GCAttachments", true)
+			Convey("Files more recent than GCAttachmentsMinAge should be kept", func() {
+				tools.Config.Set("GCAttachmentsMinAge", time.Hour)
+				collectAttachmentsGarbage()
+				So(stored(unused), ShouldBeTrue)
+				So(stored(used), ShouldBeTrue)
+			})
+			Convey("Unreferenced files should be removed", func() {
+				tools.Config.Set("GCAttachmentsMinAge", time.Duration(0))
+				collectAttachmentsGarbage()
+				So(stored(unused), ShouldBeFalse)
+				So(stored(used), ShouldBeTrue)
+			})
+			Reset(func() {
+				env := models.NewEnvironment(1)
+				env.Pool("Book").Filter("Name", "=", "Garbage").Unlink()
+				env.Cr().Commit()
+			})
+		}
+		Reset(func() {
+			tools.Config.Set("GCAttachments", false)
+			tools.Config.Set("GCAttachmentsMinAge", 24*time.Hour)
+		})
+	})
+}
@@ -15,6 +15,8 @@
 package tools
 
 import (
+	"time"
+
 	flag "github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
@@ -44,6 +46,11 @@ func initConfig() {
 func setConfigDefaults() {
 	Config.SetDefault("DBDriver", "postgres")
 	Config.SetDefault("DBSource", "dbname=yep sslmode=disable password=yep user=yep")
+	Config.SetDefault("DataDir", "./data")
+	Config.SetDefault("Demo", false)
+	Config.SetDefault("StaticMaxAge", 86400)
+	Config.SetDefault("GCAttachments", false)
+	Config.SetDefault("GCAttachmentsMinAge", 24*time.Hour)
 }
 
 // setConfigFlags defines YEP command line flags and bind them with the Config
@@ -59,4 +66,13 @@ func setConfigFlags() {
 	Config.BindPFlag("DBDriver", flag.Lookup("db-driver"))
 	flag.StringP("db-source", "s", "", "Database source string (e.g. 'dbname=yep sslmode=disable password=yep user=yep'")
 	Config.BindPFlag("DBSource", flag.Lookup("db-source"))
+
+	flag.StringP("data-dir", "D", "./data", "Directory where YEP stores its data files, such as attachments")
+	Config.BindPFlag("DataDir", flag.Lookup("data-dir"))
+	flag.Bool("gc-attachments", false, "Remove the unreferenced files of the filestore at startup")
+	Config.BindPFlag("GCAttachments", flag.Lookup("gc-attachments"))
+	flag.Duration("gc-attachments-min-age", 24*time.Hour, "Minimum age of the unreferenced files removed with --gc-attachments")
+	Config.BindPFlag("GCAttachmentsMinAge", flag.Lookup("gc-attachments-min-age"))
+	flag.Bool("demo", false, "Load the demo data of the modules")
+	Config.BindPFlag("Demo", flag.Lookup("demo"))
 }
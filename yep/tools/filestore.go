@@ -0,0 +1,164 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// checksumRegexp matches valid filestore checksums
+var checksumRegexp = regexp.MustCompile("^[0-9a-f]{40}$")
+
+// StoredFileInfo holds the metadata of a file of the filestore
+type StoredFileInfo struct {
+	Checksum string
+	Size     int64
+	MimeType string
+	ModTime  time.Time
+}
+
+// FileStoreDir returns the directory where the filestore saves its files.
+func FileStoreDir() string {
+	return filepath.Join(Config.GetString("DataDir"), "filestore")
+}
+
+// storedFilePath returns the path of the file with the given checksum.
+// It returns an error if checksum is not a valid sha1 checksum.
+func storedFilePath(checksum string) (string, error) {
+	if !checksumRegexp.MatchString(checksum) {
+		return "", fmt.Errorf("Invalid filestore checksum '%s'", checksum)
+	}
+	return filepath.Join(FileStoreDir(), checksum[:2], checksum), nil
+}
+
+// StoreFile saves the content of the given reader in the filestore and
+// returns its sha1 checksum, which identifies the content in the filestore.
+// Storing the same content twice yields the same checksum and only one file.
+func StoreFile(r io.Reader) (string, error) {
+	if err := os.MkdirAll(FileStoreDir(), 0700); err != nil {
+		return "", err
+	}
+	tmpFile, err := ioutil.TempFile(FileStoreDir(), "upload-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmpFile.Name())
+	hash := sha1.New()
+	_, err = io.Copy(io.MultiWriter(tmpFile, hash), r)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	checksum := hex.EncodeToString(hash.Sum(nil))
+	path, _ := storedFilePath(checksum)
+	if _, err := os.Stat(path); err == nil {
+		// We already have this content. Touch it so that it is not
+		// garbage collected before being referenced.
+		now := time.Now()
+		return checksum, os.Chtimes(path, now, now)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", err
+	}
+	return checksum, os.Rename(tmpFile.Name(), path)
+}
+
+// OpenStoredFile opens the file with the given checksum for reading.
+func OpenStoredFile(checksum string) (*os.File, error) {
+	path, err := storedFilePath(checksum)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+// StatStoredFile returns the metadata of the file with the given checksum.
+// The mimetype is detected from the beginning of the content.
+func StatStoredFile(checksum string) (StoredFileInfo, error) {
+	file, err := OpenStoredFile(checksum)
+	if err != nil {
+		return StoredFileInfo{}, err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return StoredFileInfo{}, err
+	}
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return StoredFileInfo{}, err
+	}
+	return StoredFileInfo{
+		Checksum: checksum,
+		Size:     stat.Size(),
+		MimeType: http.DetectContentType(head[:n]),
+		ModTime:  stat.ModTime(),
+	}, nil
+}
+
+// DeleteStoredFile removes the file with the given checksum from the filestore.
+func DeleteStoredFile(checksum string) error {
+	path, err := storedFilePath(checksum)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// ListStoredFiles returns the checksums of all the files of the filestore
+// that have not been modified since minAge.
+func ListStoredFiles(minAge time.Duration) ([]string, error) {
+	var res []string
+	limit := time.Now().Add(-minAge)
+	err := filepath.Walk(FileStoreDir(), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == FileStoreDir() {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if info.IsDir() || !checksumRegexp.MatchString(info.Name()) || info.ModTime().After(limit) {
+			return nil
+		}
+		res = append(res, info.Name())
+		return nil
+	})
+	return res, err
+}
+
+// HumanSize returns the given size in bytes in a human readable form,
+// such as "12.50 Kb".
+func HumanSize(size int64) string {
+	units := []string{"bytes", "Kb", "Mb", "Gb", "Tb"}
+	s := float64(size)
+	i := 0
+	for s >= 1024 && i < len(units)-1 {
+		s /= 1024
+		i++
+	}
+	return fmt.Sprintf("%0.2f %s", s, units[i])
+}
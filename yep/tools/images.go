@@ -0,0 +1,110 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	// Register the gif format for decoding
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+// CheckImage returns an error if the given data is not a PNG, JPEG or GIF image.
+func CheckImage(data []byte) error {
+	if _, _, err := image.DecodeConfig(bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("Invalid image: %s", err)
+	}
+	return nil
+}
+
+// ResizeImage returns the given PNG, JPEG or GIF image scaled down so that
+// it fits in a square of maxSize pixels, keeping its aspect ratio.
+// JPEG images are re-encoded as JPEG, others as PNG. Images that already
+// fit in the square are returned unchanged.
+func ResizeImage(data []byte, maxSize int) ([]byte, error) {
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid image: %s", err)
+	}
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= maxSize && height <= maxSize {
+		return data, nil
+	}
+	newWidth, newHeight := maxSize, maxSize
+	if width > height {
+		newHeight = maxInt(1, (height*maxSize+width/2)/width)
+	} else {
+		newWidth = maxInt(1, (width*maxSize+height/2)/height)
+	}
+	dst := scaleDown(src, newWidth, newHeight)
+
+	var buf bytes.Buffer
+	if format == "jpeg" {
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 90})
+	} else {
+		err = png.Encode(&buf, dst)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// scaleDown returns a new image of the given size made from src by
+// averaging the source pixels covered by each destination pixel.
+func scaleDown(src image.Image, width, height int) image.Image {
+	bounds := src.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+	dst := image.NewRGBA64(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*srcHeight/height
+		y1 := bounds.Min.Y + maxInt((y+1)*srcHeight/height, y*srcHeight/height+1)
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*srcWidth/width
+			x1 := bounds.Min.X + maxInt((x+1)*srcWidth/width, x*srcWidth/width+1)
+			var r, g, b, a, count uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r += uint64(pr)
+					g += uint64(pg)
+					b += uint64(pb)
+					a += uint64(pa)
+					count++
+				}
+			}
+			dst.SetRGBA64(x, y, color.RGBA64{
+				R: uint16(r / count),
+				G: uint16(g / count),
+				B: uint16(b / count),
+				A: uint16(a / count),
+			})
+		}
+	}
+	return dst
+}
+
+// maxInt returns the greater of a and b
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -16,21 +16,60 @@ package tools
 
 import (
 	"fmt"
-	"io/ioutil"
+	"io/fs"
+	"path"
+	"strings"
 )
 
+// moduleFSs are the virtual filesystems of the modules directories,
+// by module name.
+var moduleFSs = make(map[string]fs.FS)
+
+// RegisterModuleFS registers fsys as the virtual filesystem of the directory
+// of the given module, holding its 'static', 'templates', 'data', 'demo' and
+// 'views' directories.
+func RegisterModuleFS(module string, fsys fs.FS) {
+	moduleFSs[module] = fsys
+}
+
+// ModuleFS returns the virtual filesystem of the directory of the given
+// module, or nil if the module has not registered any.
+func ModuleFS(module string) fs.FS {
+	return moduleFSs[module]
+}
+
 // ListStaticFiles get all file names of the static files that are in
-// the "server/static/*/<subDir>" directories.
+// the "static/<subDir>" directory of the given modules. File names are
+// given as URL paths of the form "/<module>/static/<subDir>/<file>".
 func ListStaticFiles(subDir string, modules []string) []string {
 	var res []string
 	for _, module := range modules {
-		dirName := fmt.Sprintf("yep/server/static/%s/%s", module, subDir)
-		fileInfos, _ := ioutil.ReadDir(dirName)
-		for _, fi := range fileInfos {
-			if !fi.IsDir() {
-				res = append(res, fmt.Sprintf("%s/%s", dirName, fi.Name()))
+		fsys := ModuleFS(module)
+		if fsys == nil {
+			continue
+		}
+		dirName := path.Join("static", subDir)
+		entries, _ := fs.ReadDir(fsys, dirName)
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				res = append(res, path.Join("/", module, "static", subDir, entry.Name()))
 			}
 		}
 	}
 	return res
 }
+
+// ReadStaticFile returns the content of the static file given by its URL
+// path of the form "/<module>/static/<file>", as returned by ListStaticFiles.
+// The file is read from the virtual filesystem of the module.
+func ReadStaticFile(urlPath string) ([]byte, error) {
+	tokens := strings.SplitN(strings.TrimPrefix(path.Clean(urlPath), "/"), "/", 2)
+	if len(tokens) != 2 || !strings.HasPrefix(tokens[1], "static/") {
+		return nil, fmt.Errorf("%s is not the URL path of a static file", urlPath)
+	}
+	fsys := ModuleFS(tokens[0])
+	if fsys == nil {
+		return nil, fmt.Errorf("unknown module %s", tokens[0])
+	}
+	return fs.ReadFile(fsys, tokens[1])
+}
@@ -0,0 +1,554 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// PyFunc is a function that can be called from an evaluated Python expression.
+// args are the positional arguments and kwargs the keyword arguments of the call.
+type PyFunc func(args []interface{}, kwargs map[string]interface{}) (interface{}, error)
+
+// PyEnv holds the variables available when evaluating a Python expression,
+// such as uid, active_id or context_today. Values can be of any type
+// returned by EvalPy, or a PyFunc to be called.
+type PyEnv map[string]interface{}
+
+// pyBuiltins are the variables available in all evaluated expressions,
+// unless they are overridden in the PyEnv.
+var pyBuiltins = PyEnv{
+	"context_today": PyFunc(func(args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+		now := time.Now()
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()), nil
+	}),
+	"time": map[string]interface{}{
+		"strftime": PyFunc(func(args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+			if len(args) != 1 {
+				return nil, errors.New("strftime() takes exactly 1 argument")
+			}
+			return pyStrftime(time.Now(), args[0])
+		}),
+	},
+}
+
+/*
+EvalPy safely evaluates the given Python expression with the variables of env.
+
+Only a subset of Python is supported: literals (strings, numbers, True, False,
+None), lists, tuples, dicts, variables, attribute and item access, and calls to
+the PyFunc of env. Values are returned as string, int64, float64, bool, nil,
+[]interface{} for lists and tuples, map[string]interface{} for dicts and
+time.Time for dates. Dicts have a 'get' method and dates a 'strftime' method.
+*/
+func EvalPy(src string, env PyEnv) (interface{}, error) {
+	tokens, err := pyTokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := pyParser{tokens: tokens, env: env}
+	res, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != pyEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", tok.value, tok.pos)
+	}
+	return res, nil
+}
+
+// EvalPyContext evaluates the given Python dict expression, such as
+// "{'default_type': 'out'}", into a Context. An empty string gives an empty Context.
+func EvalPyContext(src string, env PyEnv) (Context, error) {
+	if strings.TrimSpace(src) == "" {
+		return make(Context), nil
+	}
+	res, err := EvalPy(src, env)
+	if err != nil {
+		return nil, err
+	}
+	dict, ok := res.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("context must be a dict, got %T", res)
+	}
+	return Context(dict), nil
+}
+
+// EvalPyList evaluates the given Python list expression, such as a domain
+// "[('state','=','draft')]", into a slice. An empty string gives an empty slice.
+func EvalPyList(src string, env PyEnv) ([]interface{}, error) {
+	if strings.TrimSpace(src) == "" {
+		return []interface{}{}, nil
+	}
+	res, err := EvalPy(src, env)
+	if err != nil {
+		return nil, err
+	}
+	list, ok := res.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a list, got %T", res)
+	}
+	return list, nil
+}
+
+type pyTokenKind int
+
+const (
+	pyEOF pyTokenKind = iota
+	pyName
+	pyString
+	pyInt
+	pyFloat
+	pyPunct
+)
+
+type pyToken struct {
+	kind  pyTokenKind
+	value string
+	pos   int
+}
+
+// pyTokenize splits the given Python expression into tokens
+func pyTokenize(src string) ([]pyToken, error) {
+	var tokens []pyToken
+	runes := []rune(src)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '_' || unicode.IsLetter(r):
+			start := i
+			for i < len(runes) && (runes[i] == '_' || unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+				i++
+			}
+			tokens = append(tokens, pyToken{kind: pyName, value: string(runes[start:i]), pos: start})
+		case unicode.IsDigit(r) || r == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1]):
+			start := i
+			kind := pyInt
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.' || runes[i] == 'e' || runes[i] == 'E' ||
+				(runes[i] == '-' || runes[i] == '+') && (runes[i-1] == 'e' || runes[i-1] == 'E')) {
+				if !unicode.IsDigit(runes[i]) {
+					kind = pyFloat
+				}
+				i++
+			}
+			tokens = append(tokens, pyToken{kind: kind, value: string(runes[start:i]), pos: start})
+		case r == '\'' || r == '"':
+			start := i
+			var sb bytes.Buffer
+			for i++; ; i++ {
+				if i >= len(runes) {
+					return nil, fmt.Errorf("unterminated string at position %d", start)
+				}
+				if runes[i] == r {
+					i++
+					break
+				}
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+					switch runes[i] {
+					case 'n':
+						sb.WriteRune('\n')
+					case 't':
+						sb.WriteRune('\t')
+					case 'r':
+						sb.WriteRune('\r')
+					default:
+						sb.WriteRune(runes[i])
+					}
+					continue
+				}
+				sb.WriteRune(runes[i])
+			}
+			tokens = append(tokens, pyToken{kind: pyString, value: sb.String(), pos: start})
+		case strings.ContainsRune("[](){},:.-=", r):
+			tokens = append(tokens, pyToken{kind: pyPunct, value: string(r), pos: i})
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected character %q at position %d", r, i)
+		}
+	}
+	tokens = append(tokens, pyToken{kind: pyEOF, pos: len(runes)})
+	return tokens, nil
+}
+
+// pyParser is a recursive descent parser that evaluates
+// Python expressions while parsing them.
+type pyParser struct {
+	tokens []pyToken
+	pos    int
+	env    PyEnv
+}
+
+// peek returns the current token without consuming it
+func (p *pyParser) peek() pyToken {
+	return p.tokens[p.pos]
+}
+
+// next consumes and returns the current token
+func (p *pyParser) next() pyToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != pyEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// isPunct returns true if the current token is the given punctuation
+func (p *pyParser) isPunct(value string) bool {
+	tok := p.peek()
+	return tok.kind == pyPunct && tok.value == value
+}
+
+// expect consumes the given punctuation or returns an error
+func (p *pyParser) expect(value string) error {
+	if !p.isPunct(value) {
+		tok := p.peek()
+		return fmt.Errorf("expected %q at position %d, got %q", value, tok.pos, tok.value)
+	}
+	p.next()
+	return nil
+}
+
+// parseExpr parses an expression with its trailing attribute accesses,
+// item accesses and calls.
+func (p *pyParser) parseExpr() (interface{}, error) {
+	val, err := p.parseAtom()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.isPunct("."):
+			p.next()
+			tok := p.next()
+			if tok.kind != pyName {
+				return nil, fmt.Errorf("expected attribute name at position %d", tok.pos)
+			}
+			if val, err = pyAttribute(val, tok.value); err != nil {
+				return nil, err
+			}
+		case p.isPunct("["):
+			p.next()
+			key, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err = p.expect("]"); err != nil {
+				return nil, err
+			}
+			if val, err = pyItem(val, key); err != nil {
+				return nil, err
+			}
+		case p.isPunct("("):
+			fn, ok := val.(PyFunc)
+			if !ok {
+				return nil, fmt.Errorf("%T is not callable", val)
+			}
+			args, kwargs, err := p.parseCallArgs()
+			if err != nil {
+				return nil, err
+			}
+			if val, err = fn(args, kwargs); err != nil {
+				return nil, err
+			}
+		default:
+			return val, nil
+		}
+	}
+}
+
+// parseAtom parses a literal, a container or a variable
+func (p *pyParser) parseAtom() (interface{}, error) {
+	tok := p.next()
+	switch tok.kind {
+	case pyString:
+		res := tok.value
+		// Adjacent strings are concatenated
+		for p.peek().kind == pyString {
+			res += p.next().value
+		}
+		return res, nil
+	case pyInt:
+		return strconv.ParseInt(tok.value, 10, 64)
+	case pyFloat:
+		return strconv.ParseFloat(tok.value, 64)
+	case pyName:
+		switch tok.value {
+		case "True":
+			return true, nil
+		case "False":
+			return false, nil
+		case "None":
+			return nil, nil
+		}
+		if val, ok := p.env[tok.value]; ok {
+			return val, nil
+		}
+		if val, ok := pyBuiltins[tok.value]; ok {
+			return val, nil
+		}
+		return nil, fmt.Errorf("name %q is not defined", tok.value)
+	case pyPunct:
+		switch tok.value {
+		case "-":
+			val, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			switch v := val.(type) {
+			case int64:
+				return -v, nil
+			case float64:
+				return -v, nil
+			}
+			return nil, fmt.Errorf("bad operand type for unary -: %T", val)
+		case "[":
+			return p.parseSequence("]")
+		case "(":
+			items, err := p.parseSequence(")")
+			if err != nil {
+				return nil, err
+			}
+			if len(items) == 1 && !p.tokens[p.pos-2].isComma() {
+				// Parenthesized expression, not a tuple
+				return items[0], nil
+			}
+			return items, nil
+		case "{":
+			return p.parseDict()
+		}
+	case pyEOF:
+		return nil, errors.New("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q at position %d", tok.value, tok.pos)
+}
+
+// isComma returns true if this token is a comma
+func (t pyToken) isComma() bool {
+	return t.kind == pyPunct && t.value == ","
+}
+
+// parseSequence parses comma separated expressions until the given closing
+// punctuation. A trailing comma is allowed.
+func (p *pyParser) parseSequence(closing string) ([]interface{}, error) {
+	res := []interface{}{}
+	for !p.isPunct(closing) {
+		item, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, item)
+		if !p.isPunct(closing) {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+	}
+	p.next()
+	return res, nil
+}
+
+// parseDict parses the items of a dict until the closing brace.
+func (p *pyParser) parseDict() (map[string]interface{}, error) {
+	res := make(map[string]interface{})
+	for !p.isPunct("}") {
+		key, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expect(":"); err != nil {
+			return nil, err
+		}
+		value, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		res[fmt.Sprintf("%v", key)] = value
+		if !p.isPunct("}") {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+	}
+	p.next()
+	return res, nil
+}
+
+// parseCallArgs parses the positional and keyword arguments of a call
+func (p *pyParser) parseCallArgs() ([]interface{}, map[string]interface{}, error) {
+	args := []interface{}{}
+	kwargs := make(map[string]interface{})
+	if err := p.expect("("); err != nil {
+		return nil, nil, err
+	}
+	for !p.isPunct(")") {
+		tok := p.peek()
+		if tok.kind == pyName && p.tokens[p.pos+1].kind == pyPunct && p.tokens[p.pos+1].value == "=" {
+			p.pos += 2
+			value, err := p.parseExpr()
+			if err != nil {
+				return nil, nil, err
+			}
+			kwargs[tok.value] = value
+		} else {
+			if len(kwargs) > 0 {
+				return nil, nil, fmt.Errorf("positional argument follows keyword argument at position %d", tok.pos)
+			}
+			value, err := p.parseExpr()
+			if err != nil {
+				return nil, nil, err
+			}
+			args = append(args, value)
+		}
+		if !p.isPunct(")") {
+			if err := p.expect(","); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	p.next()
+	return args, kwargs, nil
+}
+
+// pyAttribute returns the attribute with the given name of val.
+// Attributes of dicts are their keys, except for the 'get' method.
+func pyAttribute(val interface{}, name string) (interface{}, error) {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		return pyDictAttribute(v, name)
+	case Context:
+		return pyDictAttribute(v, name)
+	case PyEnv:
+		return pyDictAttribute(v, name)
+	case time.Time:
+		if name == "strftime" {
+			return PyFunc(func(args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+				if len(args) != 1 {
+					return nil, errors.New("strftime() takes exactly 1 argument")
+				}
+				return pyStrftime(v, args[0])
+			}), nil
+		}
+	}
+	return nil, fmt.Errorf("%T has no attribute %q", val, name)
+}
+
+// pyDictAttribute returns the attribute with the given name of the given dict
+func pyDictAttribute(dict map[string]interface{}, name string) (interface{}, error) {
+	if name == "get" {
+		return PyFunc(func(args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+			if len(args) < 1 || len(args) > 2 {
+				return nil, errors.New("get() takes 1 or 2 arguments")
+			}
+			if res, ok := dict[fmt.Sprintf("%v", args[0])]; ok {
+				return res, nil
+			}
+			if len(args) == 2 {
+				return args[1], nil
+			}
+			return nil, nil
+		}), nil
+	}
+	if res, ok := dict[name]; ok {
+		return res, nil
+	}
+	return nil, fmt.Errorf("dict has no attribute %q", name)
+}
+
+// pyItem returns the item of val with the given key
+func pyItem(val interface{}, key interface{}) (interface{}, error) {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		return pyDictItem(v, key)
+	case Context:
+		return pyDictItem(v, key)
+	case []interface{}:
+		idx, ok := key.(int64)
+		if !ok {
+			return nil, fmt.Errorf("list indices must be integers, not %T", key)
+		}
+		if idx < 0 {
+			idx += int64(len(v))
+		}
+		if idx < 0 || idx >= int64(len(v)) {
+			return nil, errors.New("list index out of range")
+		}
+		return v[idx], nil
+	}
+	return nil, fmt.Errorf("%T is not subscriptable", val)
+}
+
+// pyDictItem returns the value of the given dict for the given key
+func pyDictItem(dict map[string]interface{}, key interface{}) (interface{}, error) {
+	res, ok := dict[fmt.Sprintf("%v", key)]
+	if !ok {
+		return nil, fmt.Errorf("key %v not found", key)
+	}
+	return res, nil
+}
+
+// pyStrftimeDirectives maps Python strftime directives to Go time layouts
+var pyStrftimeDirectives = map[rune]string{
+	'Y': "2006",
+	'y': "06",
+	'm': "01",
+	'd': "02",
+	'H': "15",
+	'I': "03",
+	'M': "04",
+	'S': "05",
+	'p': "PM",
+	'b': "Jan",
+	'B': "January",
+	'a': "Mon",
+	'A': "Monday",
+	'z': "-0700",
+	'Z': "MST",
+}
+
+// pyStrftime formats the given time with the given Python strftime format
+func pyStrftime(t time.Time, format interface{}) (interface{}, error) {
+	fmtStr, ok := format.(string)
+	if !ok {
+		return nil, fmt.Errorf("strftime() argument must be str, not %T", format)
+	}
+	var sb bytes.Buffer
+	runes := []rune(fmtStr)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '%' || i+1 >= len(runes) {
+			sb.WriteRune(runes[i])
+			continue
+		}
+		i++
+		if runes[i] == '%' {
+			sb.WriteRune('%')
+			continue
+		}
+		layout, ok := pyStrftimeDirectives[runes[i]]
+		if !ok {
+			return nil, fmt.Errorf("unsupported strftime directive %%%c", runes[i])
+		}
+		sb.WriteString(t.Format(layout))
+	}
+	return sb.String(), nil
+}
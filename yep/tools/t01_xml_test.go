@@ -0,0 +1,51 @@
+// Copyright 2016 NDP Systèmes. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"testing"
+	"testing/fstest"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConcatStaticXML(t *testing.T) {
+	Convey("Testing the concatenation of static XML files", t, func() {
+		RegisterModuleFS("test_xml_a", fstest.MapFS{
+			"static/src/xml/a.xml":     {Data: []byte(`<templates><t t-name="a"/></templates>`)},
+			"static/src/xml/b.xml":     {Data: []byte(`<templates><t t-name="b"/></templates>`)},
+			"static/src/xml/sub/c.xml": {Data: []byte(`<templates><t t-name="c"/></templates>`)},
+		})
+		RegisterModuleFS("test_xml_b", fstest.MapFS{
+			"static/src/xml/d.xml": {Data: []byte(`<templates><t t-name="d"/></templates>`)},
+		})
+		Convey("ListStaticFiles should give the URL paths of the files", func() {
+			So(ListStaticFiles("src/xml", []string{"test_xml_a", "unknown", "test_xml_b"}), ShouldResemble, []string{
+				"/test_xml_a/static/src/xml/a.xml",
+				"/test_xml_a/static/src/xml/b.xml",
+				"/test_xml_b/static/src/xml/d.xml",
+			})
+		})
+		Convey("ConcatXML should read the files listed by ListStaticFiles", func() {
+			res, _ := ConcatXML(ListStaticFiles("src/xml", []string{"test_xml_a", "test_xml_b"}))
+			So(string(res), ShouldEqual, `<templates><t t-name="a"/><t t-name="b"/><t t-name="d"/></templates>`)
+		})
+		Convey("ConcatXML should panic on files that cannot be read", func() {
+			So(func() { ConcatXML([]string{"/test_xml_a/static/src/xml/missing.xml"}) }, ShouldPanic)
+			So(func() { ConcatXML([]string{"/unknown/static/src/xml/a.xml"}) }, ShouldPanic)
+			So(func() { ConcatXML([]string{"/test_xml_a/views/a.xml"}) }, ShouldPanic)
+		})
+	})
+}
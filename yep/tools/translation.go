@@ -14,6 +14,8 @@
 
 package tools
 
+import "sync"
+
 type LangDirection string
 
 const (
@@ -30,3 +32,34 @@ type LangParameters struct {
 	ID           int64         `json:"id"`
 	Grouping     string        `json:"grouping"`
 }
+
+// translations holds the translated strings, indexed by language code
+// and then by source string.
+var translations = struct {
+	sync.RWMutex
+	byLang map[string]map[string]string
+}{
+	byLang: make(map[string]map[string]string),
+}
+
+// AddTranslation registers value as the translation of the given source
+// string in the given language.
+func AddTranslation(lang, source, value string) {
+	translations.Lock()
+	defer translations.Unlock()
+	if _, ok := translations.byLang[lang]; !ok {
+		translations.byLang[lang] = make(map[string]string)
+	}
+	translations.byLang[lang][source] = value
+}
+
+// TranslateString returns the translation of the given source string in
+// the given language. It returns source itself if no translation exists.
+func TranslateString(lang, source string) string {
+	translations.RLock()
+	defer translations.RUnlock()
+	if value, ok := translations.byLang[lang][source]; ok {
+		return value
+	}
+	return source
+}
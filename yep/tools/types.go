@@ -37,9 +37,12 @@ const (
 	DATETIME  FieldType = "datetime"
 	FLOAT     FieldType = "float"
 	HTML      FieldType = "html"
+	IMAGE     FieldType = "image"
 	INTEGER   FieldType = "integer"
+	JSON      FieldType = "json"
 	MANY2MANY FieldType = "many2many"
 	MANY2ONE  FieldType = "many2one"
+	MONETARY  FieldType = "monetary"
 	ONE2MANY  FieldType = "one2many"
 	ONE2ONE   FieldType = "one2one"
 	REV2ONE   FieldType = "rev2one"
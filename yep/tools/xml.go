@@ -17,7 +17,7 @@ package tools
 import (
 	"crypto/sha1"
 	"encoding/xml"
-	"io/ioutil"
+	"fmt"
 )
 
 type basicXML struct {
@@ -26,27 +26,43 @@ type basicXML struct {
 }
 
 /*
-ConcatXML concatenates the XML content of the files given by fileNames
-into a valid XML by importing all children of the root node into the
-root node of the first file.
+ConcatXML concatenates the XML content of the static files given by their
+URL paths, as returned by ListStaticFiles, into a valid XML by importing
+all children of the root node into the root node of the first file.
+It panics if a file cannot be read or parsed.
 */
 func ConcatXML(fileNames []string) ([]byte, [sha1.Size]byte) {
+	docs := make([][]byte, len(fileNames))
+	for i, fileName := range fileNames {
+		data, err := ReadStaticFile(fileName)
+		if err != nil {
+			LogAndPanic(log, "Unable to read XML file", "file", fileName, "error", err)
+		}
+		docs[i] = data
+	}
+	res, err := ConcatXMLData(docs...)
+	if err != nil {
+		LogAndPanic(log, "Unable to concatenate XML files", "files", fileNames, "error", err)
+	}
+	return res, sha1.Sum(res)
+}
+
+/*
+ConcatXMLData concatenates the given XML documents into a valid XML by
+importing all children of the root node into the root node of the first
+document. It returns an error if a document cannot be parsed.
+*/
+func ConcatXMLData(docs ...[]byte) ([]byte, error) {
 	var reStruct basicXML
-	for _, fileName := range fileNames {
+	for i, doc := range docs {
 		var content basicXML
-		cnt, _ := ioutil.ReadFile(fileName)
-		err := xml.Unmarshal(cnt, &content)
-		if err != nil {
-			LogAndPanic(log, "Unable to parse file", "file", fileName)
+		if err := xml.Unmarshal(doc, &content); err != nil {
+			return nil, fmt.Errorf("unable to parse document %d: %s", i, err)
 		}
 		if reStruct.XMLName.Local == "" {
 			reStruct.XMLName = content.XMLName
 		}
 		reStruct.Data += content.Data
 	}
-	res, err := xml.Marshal(reStruct)
-	if err != nil {
-		LogAndPanic(log, "Unable to convert back to XML", "error", err)
-	}
-	return res, sha1.Sum(res)
+	return xml.Marshal(reStruct)
 }